@@ -0,0 +1,138 @@
+// Package analyzer exposes the checks of gocomments as a go/analysis
+// Analyzer, so that they run in go vet, gopls or golangci-lint.
+//
+// Each exported declaration without doc comment, and each generated comment
+// whose declaration changed since it was written, is reported with a
+// suggested fix holding the comment generated offline by the default
+// provider. Running in go vet and gopls, the analyzer sends no request: the
+// comments of the AI providers and the plugins of the .gocomments
+// configuration are only used when found in an existing response cache,
+// filled by the gocomments command.
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/tools/go/analysis"
+
+	"github.com/ariden/gocomments/internal/comments"
+)
+
+// Analyzer reports the missing and the stale doc comments with the fixes
+// adding them.
+var Analyzer = &analysis.Analyzer{
+	Name: "gocomments",
+	Doc: `report the missing and stale doc comments
+
+The exported declarations without doc comment and the generated comments
+out of date with their declaration are reported, with a suggested fix
+holding the comment generated by gocomments. No request is sent to the
+AI providers, whose comments are only read from the response cache.`,
+	URL: "https://github.com/ariden83/gocomments",
+	Run: run,
+}
+
+// The flags of the analyzer, like the ones of the gocomments command.
+var (
+	local    string
+	prefixes []string
+	noCache  bool
+	cacheDir string
+)
+
+func init() {
+	Analyzer.Flags.StringVar(&local, "local", "", "put imports beginning with this string after 3rd-party package")
+	Analyzer.Flags.Var((*comments.ArrayStringFlag)(&prefixes), "prefix", "relative local prefix to from a new import group (can be given several times)")
+	Analyzer.Flags.BoolVar(&noCache, "no-cache", false, "do not read nor write the cache of the comments of the AI providers")
+	Analyzer.Flags.StringVar(&cacheDir, "cache-dir", "", "directory of the cache of the comments of the AI providers (default gocomments in the user cache directory)")
+}
+
+// The configurations and the response cache shared by the passes, created on
+// the first one once the flags are parsed. The response cache is only read
+// when its directory exists.
+var (
+	setupOnce     sync.Once
+	configCache   *comments.CommentConfigCache
+	responseCache *comments.ResponseCache
+)
+
+func setup() {
+	configCache = comments.NewConfigCache(local, prefixes)
+	if !noCache {
+		responseCache = comments.NewResponseCache(cacheDir)
+	}
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	setupOnce.Do(setup)
+
+	var modulePath string
+	if pass.Module != nil {
+		modulePath = pass.Module.Path
+	}
+
+	readFile := pass.ReadFile
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
+
+	for _, f := range pass.Files {
+		tokFile := pass.Fset.File(f.Pos())
+		if tokFile == nil {
+			continue
+		}
+
+		src, err := readFile(tokFile.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		// The source read may differ from the one of the pass, like for the
+		// files generated by cgo: its positions would not match.
+		if tokFile.Size() != len(src) {
+			continue
+		}
+
+		suggestions, err := comments.Suggest(context.Background(), tokFile.Name(), src, configCache, comments.Options{
+			Cache:   responseCache,
+			Offline: true,
+		}, &comments.TypedFile{
+			Fset:       pass.Fset,
+			File:       f,
+			Pkg:        pass.Pkg,
+			Info:       pass.TypesInfo,
+			ModulePath: modulePath,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", tokFile.Name(), err)
+		}
+
+		for _, s := range suggestions {
+			diagnostic := analysis.Diagnostic{
+				Pos:      tokFile.Pos(s.Position.Offset),
+				Category: s.Rule,
+				Message:  s.Message(),
+			}
+			if s.Text != "" {
+				message := "Add the generated comment"
+				if s.Rule == comments.RuleStale {
+					message = "Replace the stale comment"
+				}
+				diagnostic.SuggestedFixes = []analysis.SuggestedFix{{
+					Message: message,
+					TextEdits: []analysis.TextEdit{{
+						Pos:     tokFile.Pos(s.Start),
+						End:     tokFile.Pos(s.End),
+						NewText: []byte(s.Text),
+					}},
+				}}
+			}
+			pass.Report(diagnostic)
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,113 @@
+package analyzer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/packages"
+)
+
+// analyzerSrc holds a missing comment on a function, a field and an
+// interface method, and a stale generated comment.
+const analyzerSrc = `package a
+
+func Open() {}
+
+// Store is documented.
+type Store struct {
+	Name string
+}
+
+// Closer is documented.
+type Closer interface {
+	Close() error
+}
+
+// Size is generated.
+//
+// Author: Bot #00000000.
+func Size() int { return 0 }
+
+func helper() {}
+`
+
+func TestAnalyzer(t *testing.T) {
+	noCache = true
+
+	// The analyzer comments offline, even with an AI provider.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request sent to the AI provider: %s", r.URL)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"go.mod":      "module example.com/a\n\ngo 1.22\n",
+		".gocomments": "signature: \"Bot\"\nanthropic:\n  active: true\n  url: " + server.URL + "\n  api-key: sk-test\n",
+		"a.go":        analyzerSrc,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.LoadAllSyntax, Dir: dir}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		t.Fatal("fail to load the test package")
+	}
+
+	graph, err := checker.Analyze([]*analysis.Analyzer{Analyzer}, pkgs, nil)
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+
+	type result struct {
+		Line     int
+		Category string
+		Message  string
+		Fix      string
+	}
+	var got []result
+	for act := range graph.All() {
+		if act.Analyzer != Analyzer {
+			continue
+		}
+		if act.Err != nil {
+			t.Fatalf("analyzer error = %v", act.Err)
+		}
+		for _, d := range act.Diagnostics {
+			r := result{
+				Line:     act.Package.Fset.Position(d.Pos).Line,
+				Category: d.Category,
+				Message:  d.Message,
+			}
+			for _, fix := range d.SuggestedFixes {
+				r.Fix = fix.Message
+				if len(fix.TextEdits) != 1 || !strings.HasPrefix(strings.TrimSpace(string(fix.TextEdits[0].NewText)), "// ") {
+					t.Errorf("%s: fix %+v, want one edit adding a comment", d.Message, fix.TextEdits)
+				}
+			}
+			got = append(got, r)
+		}
+	}
+
+	want := []result{
+		{Line: 3, Category: "missing-doc", Message: "missing comment on exported func Open", Fix: "Add the generated comment"},
+		{Line: 7, Category: "missing-doc", Message: "missing comment on exported field Store.Name", Fix: "Add the generated comment"},
+		{Line: 12, Category: "missing-doc", Message: "missing comment on exported interface-method Closer.Close", Fix: "Add the generated comment"},
+		{Line: 18, Category: "stale-doc", Message: "stale comment on func Size", Fix: "Replace the stale comment"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diagnostics = %+v, want %+v", got, want)
+	}
+}
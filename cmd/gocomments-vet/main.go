@@ -0,0 +1,17 @@
+// Command gocomments-vet runs the gocomments analyzer on packages, on its
+// own or as a vet tool:
+//
+//	gocomments-vet ./...
+//	gocomments-vet -fix ./...
+//	go vet -vettool=$(which gocomments-vet) ./...
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/ariden/gocomments/analyzer"
+)
+
+func main() {
+	singlechecker.Main(analyzer.Analyzer)
+}
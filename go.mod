@@ -1,12 +1,14 @@
 module github.com/ariden/gocomments
 
-go 1.21.6
+go 1.25.0
 
 require (
-	github.com/fatih/astrewrite v0.0.0-20191207154002-9094e544fcef
 	github.com/stoewer/go-strcase v1.3.0
+	golang.org/x/tools v0.44.0
 	gopkg.in/yaml.v3 v3.0.1
-	moul.io/http2curl v1.0.0
 )
 
-require github.com/smartystreets/goconvey v1.8.1 // indirect
+require (
+	golang.org/x/mod v0.35.0 // indirect
+	golang.org/x/sync v0.20.0 // indirect
+)
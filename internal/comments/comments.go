@@ -2,16 +2,19 @@ package comments
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
-	"go/printer"
 	"go/token"
 	"log"
+	"regexp"
+	"sort"
 	"strings"
+	"text/template"
 
-	"github.com/fatih/astrewrite"
-	"github.com/stoewer/go-strcase"
+	"github.com/ariden/gocomments/provider"
 )
 
 type file struct {
@@ -20,10 +23,98 @@ type file struct {
 	src       []byte
 	fileName  string
 	cfg       *CommentConfig
-	processor commentsProcess
+	processor *providerChain
+	report    *Report
+	types     *typesInfo
+	edits     []edit
+	requests  []docRequest
+
+	// templates are the parsed prompt templates by kind, pkgDoc the doc
+	// comment of the package and topLevel the signatures of the top-level
+	// declarations, all read on the first prompt.
+	templates map[provider.Kind]*template.Template
+	pkgDoc    *string
+	topLevel  []sibling
+
+	// changed tells whether the lines first to last changed, or is nil
+	// when all the declarations are commented.
+	changed func(first, last int) bool
+
+	// check only collects the missing and the stale comments in findings
+	// instead of generating them, unless suggest is also set.
+	check    bool
+	suggest  bool
+	findings []Finding
 }
 
-func Process(fileName string, src []byte, cache *CommentConfigCache) ([]byte, error) {
+// edit replaces the src bytes between start and end offsets by text.
+// Inserting a comment is an edit where start equals end. pos is the
+// position of the commented node.
+type edit struct {
+	start int
+	end   int
+	text  string
+	pos   token.Pos
+}
+
+// docRequest is a doc comment waiting for the comments of its declarations,
+// which are generated in a single batch for the whole file. The comments
+// of the declarations are joined and passed to apply.
+type docRequest struct {
+	decls []provider.Decl
+	apply func(txt string)
+}
+
+// Options are the settings shared by all the processed files of a run.
+type Options struct {
+	// Packages enables the type-checked mode when not nil: the packages of
+	// the processed files are loaded to resolve the types of the declarations.
+	Packages *PackageLoader
+	// Jobs is the number of declarations of a file commented concurrently
+	// by the AI providers. It defaults to one.
+	Jobs int
+	// Report records the provider of each generated comment when not nil.
+	Report *Report
+	// Changes restricts the comments to the declarations overlapping the
+	// changed lines when not nil.
+	Changes *Changes
+	// Cache stores the comments of the AI providers and the plugins when not
+	// nil, so that the declarations which did not change are not sent again.
+	// It is opened when a provider of a chain uses it first.
+	Cache *ResponseCache
+	// Offline sends no request: the comments of the AI providers and the
+	// plugins are only read from Cache when its directory already exists,
+	// the other declarations being commented by the default provider.
+	Offline bool
+}
+
+// Process adds the missing doc comments to the given Go source file
+// and returns the new content. Any other byte of src is kept unchanged.
+// The comments of the whole file are requested to the provider at once.
+func Process(ctx context.Context, fileName string, src []byte, cache *CommentConfigCache, opts Options) ([]byte, error) {
+	file, err := newFile(fileName, src, cache, opts)
+	if err != nil || file == nil {
+		return src, err
+	}
+
+	file.processor, err = newProviderChain(file.cfg, file.types, opts)
+	if err != nil {
+		return src, err
+	}
+	file.report = opts.Report
+	if opts.Changes != nil {
+		path := canonicalPath(fileName)
+		file.changed = func(first, last int) bool {
+			return opts.Changes.overlaps(path, first, last)
+		}
+	}
+
+	return file.autoComment(ctx)
+}
+
+// newFile parses the given Go source file. It returns a nil file for the
+// files which must not be commented, like the test files.
+func newFile(fileName string, src []byte, cache *CommentConfigCache, opts Options) (*file, error) {
 	fileSet := token.NewFileSet()
 
 	if strings.HasSuffix(fileName, "_test.go") {
@@ -41,468 +132,999 @@ func Process(fileName string, src []byte, cache *CommentConfigCache) ([]byte, er
 	if err != nil {
 		return nil, err
 	}
-	panic(err)
 
-	processor := newProcessor(cfg)
-
-	file := file{
-		cfg:       cfg,
-		processor: processor,
-		f:         f,
-		src:       src,
-		fileName:  fileName,
-		fSet:      fileSet,
+	var info *typesInfo
+	if opts.Packages != nil {
+		pkg, pkgFile, err := opts.Packages.load(fileName)
+		switch {
+		case err != nil:
+			log.Printf("fail to load the package of %s, its types are not resolved: %v", fileName, err)
+		case pkg.Fset.File(pkgFile.Pos()).Size() != len(src):
+			log.Printf("%s differs from the loaded package, its types are not resolved", fileName)
+		default:
+			// Use the syntax tree of the package to match its type information.
+			f, fileSet = pkgFile, pkg.Fset
+			info = &typesInfo{
+				pkg:        pkg.Types,
+				info:       pkg.TypesInfo,
+				interfaces: opts.Packages.interfaces(pkg, cfg.Interfaces),
+			}
+		}
 	}
 
-	return file.autoComment()
+	return &file{
+		cfg:      cfg,
+		f:        f,
+		src:      src,
+		fileName: fileName,
+		fSet:     fileSet,
+		types:    info,
+	}, nil
 }
 
-func (file *file) autoComment() ([]byte, error) {
-	var comments []*ast.CommentGroup
-
+func (file *file) autoComment(ctx context.Context) ([]byte, error) {
 	for _, decl := range file.f.Decls {
 		if genDecl, ok := decl.(*ast.GenDecl); ok {
 
 			switch genDecl.Tok {
 			case token.TYPE:
-				if err := file.commentType(genDecl); err != nil {
-					return nil, err
-				}
+				file.commentType(genDecl)
 			case token.CONST:
-				if err := file.commentConst(genDecl); err != nil {
-					return nil, err
-				}
+				file.commentConst(genDecl)
 			case token.VAR:
-				if err := file.commentVar(genDecl); err != nil {
-					return nil, err
-				}
+				file.commentVar(genDecl)
 			default:
 			}
 		}
 
 		if genDecl, ok := decl.(*ast.FuncDecl); ok {
-			if err := file.commentFunc(genDecl); err != nil {
-				return nil, err
-			}
+			file.commentFunc(genDecl)
 		}
 	}
 
-	file.f.Comments = comments
-
-	reWriteFunc := func(node ast.Node) (ast.Node, bool) {
-		return node, true
+	if err := file.generate(ctx); err != nil {
+		return nil, err
 	}
 
-	newAst := astrewrite.Walk(file.f, reWriteFunc)
-	var buf bytes.Buffer
-	if err := printer.Fprint(&buf, file.fSet, newAst); err != nil {
-		log.Fatal(err)
+	out := file.applyEdits()
+
+	// The comments inserted between the aligned fields or specs of a block
+	// break their alignment: a file formatted by gofmt is formatted again to
+	// stay so, the other ones are kept as they are.
+	if len(file.edits) > 0 && isFormatted(file.src) {
+		if formatted, err := format.Source(out); err == nil {
+			out = formatted
+		}
 	}
 
-	return buf.Bytes(), nil
+	return out, nil
 }
 
-func GenerateFuncCode(fn *ast.FuncDecl) string {
-	functionName := fn.Name.Name
+// isFormatted tells whether src is formatted by gofmt.
+func isFormatted(src []byte) bool {
+	formatted, err := format.Source(src)
+	return err == nil && bytes.Equal(formatted, src)
+}
 
-	var (
-		input    string
-		output   string
-		funcType string
-	)
+// request queues a doc comment generated from the comments of decls. It is
+// skipped when none of decls changed.
+func (file *file) request(apply func(txt string), decls ...provider.Decl) {
+	if len(decls) == 0 || !file.declsChanged(decls) {
+		return
+	}
+	file.requests = append(file.requests, docRequest{
+		decls: decls,
+		apply: apply,
+	})
+}
 
-	if fn.Type.Params != nil && len(fn.Type.Params.List) > 0 {
-		for i, param := range fn.Type.Params.List {
-			if i > 0 {
-				input += ", "
+// declsChanged tells whether one of decls overlaps the changed lines.
+func (file *file) declsChanged(decls []provider.Decl) bool {
+	if file.changed == nil {
+		return true
+	}
+	for _, decl := range decls {
+		if decl.Node == nil {
+			continue
+		}
+		first, last := file.fSet.Position(decl.Node.Pos()).Line, file.fSet.Position(decl.Node.End()).Line
+		if file.changed(first, last) {
+			return true
+		}
+	}
+	return false
+}
+
+// generate requests the comments of all the queued declarations to the
+// provider in a single batch, and applies them. The prompts are only
+// rendered when the chain has a provider other than the default one.
+func (file *file) generate(ctx context.Context) error {
+	prompts := file.processor.usesPrompts()
+
+	var decls []provider.Decl
+	for _, req := range file.requests {
+		for _, decl := range req.decls {
+			if prompts {
+				prompt, err := file.prompt(decl)
+				if err != nil {
+					return err
+				}
+				decl.Prompt = prompt
 			}
-			for _, name := range param.Names {
-				input += fmt.Sprintf("%s %s", name.Name, getTypeName(param.Type))
+			decls = append(decls, decl)
+		}
+	}
+	if len(decls) == 0 {
+		return nil
+	}
+
+	comments, producers, err := file.processor.comment(ctx, decls)
+	if err != nil {
+		return fmt.Errorf("fail to generate comments: %v", err)
+	}
+
+	i := 0
+	for _, req := range file.requests {
+		var texts []string
+		for _, decl := range req.decls {
+			if !comments[i].IsZero() {
+				texts = append(texts, comments[i].Text())
+				file.report.add(ReportEntry{
+					Position: file.fSet.Position(decl.Node.Pos()),
+					Kind:     decl.Kind,
+					Name:     decl.Name,
+					Provider: producers[i],
+				})
 			}
+			i++
 		}
+		req.apply(strings.Join(texts, "\n"))
 	}
 
-	if fn.Type.Results != nil && len(fn.Type.Results.List) > 0 {
-		for i, res := range fn.Type.Results.List {
-			if i > 0 {
-				output += ", "
+	return nil
+}
+
+// newDecl returns the descriptor of a declaration of the file.
+func (file *file) newDecl(kind provider.Kind, name string, node ast.Node) provider.Decl {
+	return provider.Decl{
+		Kind:     kind,
+		Name:     name,
+		Exported: token.IsExported(name),
+		Package:  file.f.Name.Name,
+		File:     file.fileName,
+		Node:     node,
+	}
+}
+
+// valueDecls returns the descriptors of the names of a const or var spec.
+func (file *file) valueDecls(kind provider.Kind, spec *ast.ValueSpec) []provider.Decl {
+	var decls []provider.Decl
+	for _, name := range spec.Names {
+		if name.Name == "_" {
+			continue
+		}
+
+		decl := file.newDecl(kind, name.Name, spec)
+		decl.Type = file.types.varType(spec, name)
+		decl.Signature = strings.TrimSpace(string(kind) + " " + name.Name + " " + decl.Type)
+		decls = append(decls, decl)
+	}
+	return decls
+}
+
+// fields returns the names and the types of a parameter or result list.
+func (file *file) fields(list *ast.FieldList) []provider.Field {
+	if list == nil {
+		return nil
+	}
+
+	var fields []provider.Field
+	for _, field := range list.List {
+		typ := file.types.typeString(field.Type)
+		if len(field.Names) == 0 {
+			fields = append(fields, provider.Field{Type: typ})
+		}
+		for _, name := range field.Names {
+			fields = append(fields, provider.Field{Name: name.Name, Type: typ})
+		}
+	}
+	return fields
+}
+
+// addDoc queues txt as the doc comment of the node starting at pos.
+// The comment lines are inserted right above the line of the node with
+// the same indentation, so the existing comments and layout are kept.
+// When old is not nil, it is a previously generated comment replaced by txt.
+// The directives of the node, like "//go:noinline", are kept right above
+// it after an empty comment line, where gofmt puts them.
+func (file *file) addDoc(pos token.Pos, old *ast.CommentGroup, txt string) {
+	lines := commentLines(txt)
+	if len(lines) == 0 {
+		return
+	}
+
+	offset := file.fSet.Position(pos).Offset
+	start := bytes.LastIndexByte(file.src[:offset], '\n') + 1
+	indent := file.src[start:offset]
+
+	// The node does not start its own line (e.g. "var a, b = 1, 2; var c int"):
+	// there is no place for a doc comment without reformatting the source.
+	if len(bytes.TrimSpace(indent)) != 0 {
+		return
+	}
+
+	end := start
+	if old != nil {
+		i, _ := file.signature(old)
+		signature := old.List[i]
+		start = bytes.LastIndexByte(file.src[:file.fSet.Position(old.Pos()).Offset], '\n') + 1
+		end = file.fSet.Position(signature.End()).Offset
+		if end < len(file.src) && file.src[end] == '\n' {
+			end++
+		}
+
+		// The directives written above the replaced comment move below it.
+		var directives []string
+		for _, c := range old.List[:i] {
+			if isDirective(c.Text) {
+				directives = append(directives, c.Text)
 			}
-			output += fmt.Sprintf("%s", getTypeName(res.Type))
-		}
-	}
-
-	if fn.Recv != nil {
-		if fn.Recv != nil && len(fn.Recv.List) > 0 {
-			funcTypeName := ""
-			txt := ""
-			switch expr := fn.Recv.List[0].Type.(type) {
-			case *ast.Ident:
-				funcTypeName = expr.Name
-				txt = funcTypeName
-			case *ast.StarExpr:
-				if f, ok := expr.X.(*ast.Ident); ok {
-					txt = "*" + f.Name
-					funcTypeName = f.Name
-				}
+		}
+		if len(directives) > 0 {
+			lines = append(append(lines, "//"), directives...)
+		}
+	} else {
+		moved := false
+		for start > 0 {
+			prev := bytes.LastIndexByte(file.src[:start-1], '\n') + 1
+			if !isDirective(string(bytes.TrimSpace(file.src[prev : start-1]))) {
+				break
 			}
+			start, moved = prev, true
+		}
+		if moved {
+			lines = append(lines, "//")
+		}
+		end = start
+	}
+
+	var buf strings.Builder
+	for _, line := range lines {
+		buf.Write(indent)
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	file.edits = append(file.edits, edit{
+		start: start,
+		end:   end,
+		text:  buf.String(),
+		pos:   pos,
+	})
+}
+
+// needsComment tells whether a comment must be generated for the declaration
+// at pos having the given doc. Comments written by humans are never touched,
+// while the signed comments previously generated are returned to be replaced
+// when the update-comments option is set and the declaration fingerprint fp
+// changed since they were written, or is unknown because they were signed
+// before the fingerprints. In the check mode, the missing comments of the
+// exported declarations and the stale comments are only recorded, or
+// recorded and generated in the suggest mode. A comment without
+// fingerprint is not known to be stale, so it is not reported.
+func (file *file) needsComment(doc *ast.CommentGroup, pos token.Pos, kind, name, fp string) (*ast.CommentGroup, bool) {
+	if doc.Text() == "" {
+		if !file.check {
+			return nil, true
+		}
+		if !isExportedName(name) {
+			return nil, false
+		}
+		file.addFinding(RuleMissing, pos, kind, name)
+		return nil, file.suggest
+	}
+
+	i, docFingerprint := file.signature(doc)
+	if i < 0 || docFingerprint == fp {
+		return nil, false
+	}
+
+	if file.check {
+		if docFingerprint == "" {
+			return nil, false
+		}
+		file.addFinding(RuleStale, pos, kind, name)
+		if file.suggest {
+			return doc, true
+		}
+		return nil, false
+	}
+
+	if file.cfg.UpdateComments == nil || !*file.cfg.UpdateComments {
+		return nil, false
+	}
+
+	return doc, true
+}
+
+// signature returns the index in doc of the "Author: <signature>." line
+// added by addSignature and the fingerprint it holds, or -1 if the comment
+// was not generated by the tool.
+func (file *file) signature(doc *ast.CommentGroup) (int, string) {
+	if doc == nil || file.cfg.Signature == nil || *file.cfg.Signature == "" {
+		return -1, ""
+	}
+
+	trailer := "// Author: " + *file.cfg.Signature
+	for i := len(doc.List) - 1; i >= 0; i-- {
+		text := strings.TrimSpace(doc.List[i].Text)
+		if !strings.HasPrefix(text, trailer) {
+			continue
+		}
+
+		if m := signatureRegexp.FindStringSubmatch(text[len(trailer):]); m != nil {
+			return i, m[1]
+		}
+	}
+
+	return -1, ""
+}
+
+// applyEdits returns the source of the file with all the queued edits.
+func (file *file) applyEdits() []byte {
+	if len(file.edits) == 0 {
+		return file.src
+	}
+
+	sort.SliceStable(file.edits, func(i, j int) bool {
+		return file.edits[i].start < file.edits[j].start
+	})
+
+	var (
+		buf  bytes.Buffer
+		last int
+	)
+	for _, e := range file.edits {
+		buf.Write(file.src[last:e.start])
+		buf.WriteString(e.text)
+		last = e.end
+	}
+	buf.Write(file.src[last:])
 
-			funcType = "(" + strings.ToLower(string(funcTypeName[0])) + " " + txt + ") "
+	return buf.Bytes()
+}
+
+// directiveRegexp matches the comment directives, like "//go:generate",
+// "//nolint:errcheck" or "//export Name", which are not part of the text of
+// a doc comment.
+var directiveRegexp = regexp.MustCompile(`^//([a-z0-9]+:[a-z0-9]|(line|extern|export) |nolint\b)`)
+
+// isDirective tells whether the comment line is a directive.
+func isDirective(line string) bool {
+	return directiveRegexp.MatchString(line)
+}
+
+// commentLines splits the generated txt into comment lines, prefixing
+// with "// " the lines the processor did not already turn into comments.
+func commentLines(txt string) []string {
+	txt = strings.TrimRight(txt, "\n")
+	if strings.TrimSpace(txt) == "" {
+		return nil
+	}
+
+	lines := strings.Split(txt, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		switch {
+		case strings.HasPrefix(line, "//"):
+		case line == "":
+			line = "//"
+		default:
+			line = "// " + line
 		}
+		lines[i] = line
 	}
 
-	return fmt.Sprintf(`func %s%s(%s) (%s)`, funcType, functionName, input, output)
+	return lines
+}
+
+// specDoc returns the doc comment of a spec and the position to insert one.
+// The parser attaches the doc of a non grouped declaration to the GenDecl.
+func specDoc(genDecl *ast.GenDecl, spec ast.Spec, doc *ast.CommentGroup) (*ast.CommentGroup, token.Pos) {
+	if genDecl.Lparen.IsValid() {
+		return doc, spec.Pos()
+	}
+	return genDecl.Doc, genDecl.Pos()
 }
 
-func (file *file) commentConst(genDecl *ast.GenDecl) error {
+// GenerateFuncCode returns the signature of the function as it is written
+// in Go, like "func (s *Set[T]) Add(values ...T) (n int, err error)".
+func GenerateFuncCode(fn *ast.FuncDecl) string {
+	var funcType string
+
+	if fn.Recv != nil && len(fn.Recv.List) > 0 {
+		recv := fn.Recv.List[0]
+		recvType := getTypeName(recv.Type)
+
+		recvName := ""
+		if len(recv.Names) > 0 {
+			recvName = recv.Names[0].Name
+		} else if name := embeddedName(recv.Type); name != "" {
+			recvName = strings.ToLower(name[:1])
+		}
+
+		funcType = "(" + strings.TrimSpace(recvName+" "+recvType) + ") "
+	}
+
+	typeParams := ""
+	if fn.Type.TypeParams != nil && len(fn.Type.TypeParams.List) > 0 {
+		typeParams = "[" + fieldListString(fn.Type.TypeParams) + "]"
+	}
+
+	return fmt.Sprintf("func %s%s%s%s", funcType, fn.Name.Name, typeParams, signatureString(fn.Type))
+}
+
+func (file *file) commentConst(genDecl *ast.GenDecl) {
+	if file.commentConstBlock(genDecl) {
+		return
+	}
+
+	for _, spec := range genDecl.Specs {
+		varSpec := spec.(*ast.ValueSpec)
+
+		doc, pos := specDoc(genDecl, varSpec, varSpec.Doc)
+		fp := file.nodeFingerprint(varSpec)
+		old, ok := file.needsComment(doc, pos, "const", varSpec.Names[0].Name, fp)
+		if !ok {
+			continue
+		}
+
+		file.request(func(txt string) {
+			file.addDoc(pos, old, file.docText(txt, fp))
+		}, file.valueDecls(provider.KindConst, varSpec)...)
+	}
+}
+
+// commentConstBlock adds a single doc comment on a block of grouped
+// constants, like an iota enumeration, instead of one on each constant.
+// The constants having their own doc comment keep it, and the other ones
+// are documented by the block doc, like with go doc. It returns false
+// when genDecl is not a block of several constants.
+func (file *file) commentConstBlock(genDecl *ast.GenDecl) bool {
+	if !genDecl.Lparen.IsValid() || len(genDecl.Specs) < 2 {
+		return false
+	}
+
+	var (
+		names      []string
+		undoc      []string
+		typeNames  []string
+		exported   bool
+		lastType   string
+		commonType = true
+	)
 	for _, spec := range genDecl.Specs {
 		varSpec := spec.(*ast.ValueSpec)
-		hasParenthesis := false
-		if genDecl.Lparen > 0 {
-			hasParenthesis = true
+
+		// The stale generated comments of the constants are still updated.
+		if varSpec.Doc.Text() != "" {
+			fp := file.nodeFingerprint(varSpec)
+			if old, ok := file.needsComment(varSpec.Doc, varSpec.Pos(), "const", varSpec.Names[0].Name, fp); ok {
+				file.request(func(txt string) {
+					file.addDoc(varSpec.Pos(), old, file.docText(txt, fp))
+				}, file.valueDecls(provider.KindConst, varSpec)...)
+			}
 		}
 
-		for _, name := range varSpec.Names {
+		// A constant without type nor value repeats the previous ones, like
+		// in an iota enumeration.
+		if varSpec.Type != nil || len(varSpec.Values) > 0 {
+			lastType = ""
+		}
+		for _, decl := range file.valueDecls(provider.KindConst, varSpec) {
+			if decl.Type != "" {
+				lastType = decl.Type
+			}
+			names = append(names, decl.Name)
+			typeNames = append(typeNames, lastType)
+			exported = exported || decl.Exported
 			if varSpec.Doc.Text() == "" {
-				exported := true
-				if !name.IsExported() {
-					exported = false
-				}
-				if decl, ok := name.Obj.Decl.(*ast.ValueSpec); ok {
-					txt, err := file.processor.commentConst(name.Name, exported)
-					if err != nil {
-						return fmt.Errorf("fail to add comments on const: %v", err)
-					}
-
-					if hasParenthesis {
-						decl.Doc = &ast.CommentGroup{
-							List: []*ast.Comment{{
-								Text:  txt,
-								Slash: decl.Pos() - 1,
-							}},
-						}
-					} else {
-						txt += "\n"
-						txt += file.addSignature()
-						genDecl.Doc = &ast.CommentGroup{
-							List: []*ast.Comment{{
-								Text:  txt,
-								Slash: genDecl.Pos() - 1,
-							}},
-						}
-					}
-				}
+				undoc = append(undoc, decl.Name)
 			}
 		}
 	}
-	return nil
+	for _, typ := range typeNames {
+		commonType = commonType && typ != "" && typ == typeNames[0]
+	}
+
+	// The block doc is checked on its first exported constant without doc.
+	name := ""
+	for _, n := range undoc {
+		if name == "" || !token.IsExported(name) && token.IsExported(n) {
+			name = n
+		}
+	}
+	if name == "" {
+		if genDecl.Doc.Text() == "" || len(names) == 0 {
+			return true
+		}
+		name = names[0]
+	}
+
+	fp := file.nodeFingerprint(genDecl)
+	old, ok := file.needsComment(genDecl.Doc, genDecl.Pos(), "const", name, fp)
+	if !ok {
+		return true
+	}
+
+	decl := file.newDecl(provider.KindConst, strings.Join(names, ", "), genDecl)
+	decl.Exported = exported
+	if commonType {
+		decl.Type = typeNames[0]
+	}
+	decl.Signature = "const (" + decl.Name + ")"
+
+	file.request(func(txt string) {
+		file.addDoc(genDecl.Pos(), old, file.docText(txt, fp))
+	}, decl)
+	return true
 }
 
-func (file *file) addSignature() string {
+// addSignature returns the trailer identifying the generated comments,
+// holding the fingerprint fp of the commented declaration.
+func (file *file) addSignature(fp string) string {
 	if file.cfg.Signature != nil && *file.cfg.Signature != "" {
+		if fp != "" {
+			return "//\n// Author: " + *file.cfg.Signature + " #" + fp + "."
+		}
 		return "//\n// Author: " + *file.cfg.Signature + "."
 	}
 	return ""
 }
 
-func (file *file) commentVar(genDecl *ast.GenDecl) error {
+// docText appends the signature holding the fingerprint fp to a generated
+// comment, so that it can be updated and checked like the other ones.
+func (file *file) docText(txt, fp string) string {
+	if strings.TrimSpace(txt) == "" {
+		return txt
+	}
+	return strings.TrimRight(txt, "\n") + "\n" + file.addSignature(fp)
+}
+
+func (file *file) commentVar(genDecl *ast.GenDecl) {
 	for _, spec := range genDecl.Specs {
 		varSpec := spec.(*ast.ValueSpec)
 
-		hasParenthesis := false
-		if genDecl.Lparen > 0 {
-			hasParenthesis = true
+		// The variables of a documented block are documented by its doc.
+		doc, pos := specDoc(genDecl, varSpec, varSpec.Doc)
+		if doc.Text() == "" && genDecl.Lparen.IsValid() && genDecl.Doc.Text() != "" {
+			continue
 		}
 
-		for _, name := range varSpec.Names {
-			if varSpec.Doc.Text() == "" {
-				exported := true
-				if !name.IsExported() {
-					exported = false
-				}
-
-				explainVar := convertVarToCamelCaseTo(name.Name)
-
-				if decl, ok := name.Obj.Decl.(*ast.ValueSpec); ok {
-
-					txt, err := file.processor.commentVar(name.Name, fmt.Sprintf("%s", decl.Type), explainVar, exported)
-					if err != nil {
-						return fmt.Errorf("fail to add comments on var: %v", err)
-					}
-
-					if hasParenthesis {
-						decl.Doc = &ast.CommentGroup{
-							List: []*ast.Comment{{
-								Text:  txt,
-								Slash: decl.Pos() - 1,
-							}},
-						}
-
-					} else {
-						txt += ".\n"
-						txt += file.addSignature()
-						genDecl.Doc = &ast.CommentGroup{
-							List: []*ast.Comment{{
-								Text:  txt,
-								Slash: genDecl.Pos() - 1,
-							}},
-						}
-					}
-				}
-			}
+		fp := file.nodeFingerprint(varSpec)
+		old, ok := file.needsComment(doc, pos, "var", varSpec.Names[0].Name, fp)
+		if !ok {
+			continue
 		}
+
+		file.request(func(txt string) {
+			file.addDoc(pos, old, file.docText(txt, fp))
+		}, file.valueDecls(provider.KindVar, varSpec)...)
 	}
-	return nil
 }
 
-func (file *file) commentType(genDecl *ast.GenDecl) error {
+func (file *file) commentType(genDecl *ast.GenDecl) {
 	for _, spec := range genDecl.Specs {
 
 		typeSpec := spec.(*ast.TypeSpec)
 
-		if typeSpec.Doc.Text() == "" {
-			privateValue := ""
-			if !typeSpec.Name.IsExported() {
-				privateValue = "private "
-			}
+		doc, pos := specDoc(genDecl, typeSpec, typeSpec.Doc)
+		fp := file.nodeFingerprint(typeSpec)
+		if old, ok := file.needsComment(doc, pos, "type", typeSpec.Name.Name, fp); ok {
+			decl := file.newDecl(provider.KindType, typeSpec.Name.Name, typeSpec)
+			decl.Type = getTypeName(typeSpec.Type)
+			decl.Signature = typeSpecString(typeSpec)
 
-			switch structType := typeSpec.Type.(type) {
-			case *ast.StructType:
-				txt := fmt.Sprintf("// %s represents a %sstructure for ", typeSpec.Name, privateValue)
-
-				var mandatoryFields []*ast.Ident
-				var optionFields []*ast.Ident
-
-				// It contains information about the type of drop-off and
-				// optionally, details about the sender's mailbox picking.
-				for _, field := range structType.Fields.List {
-					for _, f := range field.Names {
-						if _, isPointer := field.Type.(*ast.StarExpr); isPointer {
-							optionFields = append(optionFields, f)
-						} else {
-							mandatoryFields = append(mandatoryFields, f)
-						}
-					}
+			file.request(func(txt string) {
+				if implements := file.types.implements(typeSpec.Name); len(implements) > 0 && strings.TrimSpace(txt) != "" {
+					txt = strings.TrimRight(txt, "\n") + fmt.Sprintf("\nIt implements %s.", joinWords(implements))
 				}
+				file.addDoc(pos, old, file.docText(txt, fp))
+			}, decl)
+		}
 
-				if len(mandatoryFields) > 0 {
-					txt += "\n// It contains information about "
-					for i, f := range mandatoryFields {
-						if i > 0 {
-							txt += ", "
-						}
-						privateKey := "private "
-						if f.IsExported() {
-							privateKey = ""
-						}
-						txt += fmt.Sprintf("%s %s%s", indefiniteArticle(fmt.Sprintf("%s", f.Name)), privateKey, f.Name)
-					}
-				}
+		switch t := typeSpec.Type.(type) {
+		case *ast.StructType:
+			file.commentFields(typeSpec.Name.Name, t.Fields)
+		case *ast.InterfaceType:
+			file.commentMethods(typeSpec.Name.Name, t.Methods)
+		}
+	}
+}
 
-				if len(optionFields) > 0 {
-					if len(mandatoryFields) > 0 {
-						txt += " and\n// optionally "
-					} else {
-						txt += "\n// It contains optional information about "
-					}
-
-					for i, f := range optionFields {
-						if i > 0 {
-							txt += ", "
-						}
-						privateKey := "private "
-						if f.IsExported() {
-							privateKey = ""
-						}
-						txt += fmt.Sprintf("%s %s%s", indefiniteArticle(fmt.Sprintf("%s", f.Name)), privateKey, f.Name)
-					}
-				}
+// typeSpecString returns the type declaration as written in Go, like
+// "type Set[T comparable] map[T]struct{}".
+func typeSpecString(typeSpec *ast.TypeSpec) string {
+	txt := "type " + typeSpec.Name.Name
+	if typeSpec.TypeParams != nil && len(typeSpec.TypeParams.List) > 0 {
+		txt += "[" + fieldListString(typeSpec.TypeParams) + "]"
+	}
+	if typeSpec.Assign.IsValid() {
+		txt += " ="
+	}
+	return txt + " " + getTypeName(typeSpec.Type)
+}
 
-				txt += ".\n"
-				txt += file.addSignature()
+// commentFields adds the missing comments on the fields of the struct
+// typeName, including the fields of its anonymous nested structs.
+// A field having a trailing line comment is considered as documented.
+func (file *file) commentFields(typeName string, fields *ast.FieldList) {
+	if fields == nil {
+		return
+	}
 
-				genDecl.Doc = &ast.CommentGroup{
-					List: []*ast.Comment{{
-						Text:  txt,
-						Slash: typeSpec.Pos() - token.Pos(len("type ")+1),
-					}},
-				}
+	for _, field := range fields.List {
+		if field.Comment == nil {
+			file.commentField(typeName, field)
+		}
 
-			default:
-				txt := fmt.Sprintf("// %s is a type alias for the %s type.\n// It allows you to create a new type with the same\n// underlying type as int, but with a different name.\n// This can be useful for improving code readability\n// and providing more semantic meaning to your types.\n", typeSpec.Name, structType)
-				txt += file.addSignature()
-				genDecl.Doc = &ast.CommentGroup{
-					List: []*ast.Comment{{
-						Text:  txt,
-						Slash: genDecl.Pos() - 1,
-					}},
-				}
-			}
+		if nested := nestedStruct(field.Type); nested != nil && len(field.Names) > 0 {
+			file.commentFields(typeName+"."+field.Names[0].Name, nested.Fields)
 		}
 	}
+}
 
-	return nil
+// commentField adds the missing comment on a field of the struct typeName.
+func (file *file) commentField(typeName string, field *ast.Field) {
+	names := make([]string, len(field.Names))
+	for i, name := range field.Names {
+		names[i] = name.Name
+	}
+	if len(names) == 0 {
+		// An embedded field is documented by its type: check does not
+		// report it without comment.
+		if file.check && field.Doc.Text() == "" {
+			return
+		}
+		names = append(names, embeddedName(field.Type))
+	}
+
+	pos := field.Pos()
+	fp := file.nodeFingerprint(field)
+	old, ok := file.needsComment(field.Doc, pos, "field", typeName+"."+names[0], fp)
+	if !ok {
+		return
+	}
+
+	decl := file.newDecl(provider.KindField, strings.Join(names, ", "), field)
+	decl.Exported = token.IsExported(names[0])
+	decl.Parent = typeName
+	decl.Type = getTypeName(field.Type)
+	decl.Signature = fieldString(field)
+
+	file.request(func(txt string) {
+		file.addDoc(pos, old, file.docText(txt, fp))
+	}, decl)
 }
 
-func isNewFunc(name string) bool {
-	return strings.HasPrefix(name, "New")
+// commentMethods adds the missing comments on the methods and the embedded
+// interfaces of the interface typeName.
+func (file *file) commentMethods(typeName string, methods *ast.FieldList) {
+	if methods == nil {
+		return
+	}
+
+	for _, method := range methods.List {
+		if method.Comment != nil {
+			continue
+		}
+
+		// Skip the type set elements of the constraints, like "~int | ~string".
+		if len(method.Names) == 0 && embeddedName(method.Type) == "" {
+			continue
+		}
+
+		// Like the embedded fields, an embedded interface is documented by
+		// its type.
+		if len(method.Names) == 0 && file.check && method.Doc.Text() == "" {
+			continue
+		}
+
+		name := embeddedName(method.Type)
+		if len(method.Names) > 0 {
+			name = method.Names[0].Name
+		}
+
+		pos := method.Pos()
+		fp := file.nodeFingerprint(method)
+		old, ok := file.needsComment(method.Doc, pos, "interface-method", typeName+"."+name, fp)
+		if !ok {
+			continue
+		}
+
+		decl := file.newDecl(provider.KindInterfaceMethod, name, method)
+		decl.Parent = typeName
+		decl.Signature = fieldString(method)
+		if fn, ok := method.Type.(*ast.FuncType); ok {
+			decl.Params = file.fields(fn.Params)
+			decl.Results = file.fields(fn.Results)
+		}
+
+		file.request(func(txt string) {
+			file.addDoc(pos, old, file.docText(txt, fp))
+		}, decl)
+	}
 }
 
-// RequestPayload defines the structure of the request payload to the Anthropic API
-type RequestPayload struct {
-	Prompt      string  `json:"prompt"`
-	MaxTokens   int     `json:"max_tokens"`
-	Model       string  `json:"model"`
-	Temperature float64 `json:"temperature"`
+// nestedStruct returns the non empty anonymous struct declared by a field
+// type, like "struct{...}", "*struct{...}" or "[]struct{...}".
+func nestedStruct(expr ast.Expr) *ast.StructType {
+	switch t := expr.(type) {
+	case *ast.StructType:
+		if t.Fields == nil || len(t.Fields.List) == 0 {
+			return nil
+		}
+		return t
+	case *ast.StarExpr:
+		return nestedStruct(t.X)
+	case *ast.ArrayType:
+		return nestedStruct(t.Elt)
+	case *ast.MapType:
+		return nestedStruct(t.Value)
+	default:
+		return nil
+	}
 }
 
-// ResponsePayload defines the structure of the response payload from the Anthropic API
-type ResponsePayload struct {
-	Completion string `json:"completion"`
+// embeddedName returns the name of an embedded field or interface, without
+// its package and type arguments, or an empty string if expr is not a named type.
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedName(t.X)
+	default:
+		return ""
+	}
 }
 
-func (file *file) commentFunc(genDecl *ast.FuncDecl) error {
-	if genDecl.Doc.Text() == "" && genDecl.Name.Name != "main" && genDecl.Name.Name != "init" {
-		txt, err := file.processor.commentFunc(genDecl)
-		if err != nil {
-			log.Printf("fail to generate comment for func %s: %+v", genDecl.Name.Name, err)
-			return err
+// typeKind returns the kind of a named type, like "struct" or "map", from
+// its resolved type in the type-checked mode, or else from its declaration
+// in the file. It returns "type" for the types declared in other files.
+func (file *file) typeKind(expr ast.Expr) string {
+	if file.types != nil {
+		return file.types.kind(expr)
+	}
+
+	name := embeddedName(expr)
+	for _, decl := range file.f.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
 		}
-		txt += file.addSignature()
-		genDecl.Doc = &ast.CommentGroup{
-			List: []*ast.Comment{{
-				Text:  txt,
-				Slash: genDecl.Pos() - 1,
-			}},
+		for _, spec := range genDecl.Specs {
+			if typeSpec := spec.(*ast.TypeSpec); typeSpec.Name.Name == name && !typeSpec.Assign.IsValid() {
+				return syntaxKind(typeSpec.Type)
+			}
 		}
 	}
-	return nil
+	return "type"
 }
 
-func indefiniteArticle(word string) string {
-	word = strings.ToLower(word)
-	anLetters := "aeiou"
-	if strings.ContainsRune(anLetters, rune(word[0])) {
-		return "an"
+// syntaxKind returns the kind of a type expression, like typesInfo.kind
+// but from the syntax only.
+func syntaxKind(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	case *ast.MapType:
+		return "map"
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return "slice"
+		}
+		return "array"
+	case *ast.ChanType:
+		return "channel"
+	case *ast.FuncType:
+		return "function type"
+	default:
+		return "type"
 	}
-	return "a"
 }
 
+func isNewFunc(name string) bool {
+	return strings.HasPrefix(name, "New")
+}
+
+func (file *file) commentFunc(genDecl *ast.FuncDecl) {
+	if genDecl.Name.Name == "main" || genDecl.Name.Name == "init" {
+		return
+	}
+
+	kind := provider.KindFunc
+	if genDecl.Recv != nil {
+		kind = provider.KindMethod
+	}
+
+	name := genDecl.Name.Name
+	if genDecl.Recv != nil && len(genDecl.Recv.List) > 0 {
+		name = embeddedName(genDecl.Recv.List[0].Type) + "." + name
+	}
+
+	signature := GenerateFuncCode(genDecl)
+	fp := funcFingerprint(genDecl)
+	old, ok := file.needsComment(genDecl.Doc, genDecl.Pos(), string(kind), name, fp)
+	if !ok {
+		return
+	}
+
+	decl := file.newDecl(kind, genDecl.Name.Name, genDecl)
+	decl.Signature = signature
+	decl.Params = file.fields(genDecl.Type.Params)
+	decl.Results = file.fields(genDecl.Type.Results)
+	decl.Context = file.types.funcContext(genDecl)
+	decl.Errors = file.types.analyzeErrors(genDecl).describe()
+	decl.Effects = file.types.analyzeEffects(genDecl).describe()
+	if genDecl.Body != nil {
+		decl.Body = string(file.src[file.fSet.Position(genDecl.Body.Pos()).Offset:file.fSet.Position(genDecl.Body.End()).Offset])
+	}
+	if genDecl.Recv != nil && len(genDecl.Recv.List) > 0 {
+		decl.Parent = embeddedName(genDecl.Recv.List[0].Type)
+		decl.ParentKind = file.typeKind(genDecl.Recv.List[0].Type)
+	}
+
+	file.request(func(txt string) {
+		if strings.TrimSpace(txt) == "" {
+			return
+		}
+		if methods := file.types.implementedMethods(genDecl); len(methods) > 0 {
+			txt = strings.TrimRight(txt, "\n") + fmt.Sprintf("\nIt implements %s.", joinWords(methods))
+		}
+		txt = strings.TrimRight(txt, "\n") + "\n" + file.addSignature(fp)
+		file.addDoc(genDecl.Pos(), old, txt)
+	}, decl)
+}
+
+// getTypeName returns the Go source of a type expression, like
+// "map[string][]*pkg.Item", "func(context.Context) error" or "Set[T]".
 func getTypeName(expr ast.Expr) string {
 	switch expr := expr.(type) {
+	case nil:
+		return ""
 	case *ast.Ident:
 		return expr.Name
+	case *ast.BasicLit:
+		return expr.Value
 	case *ast.StarExpr:
 		return "*" + getTypeName(expr.X)
+	case *ast.ParenExpr:
+		return "(" + getTypeName(expr.X) + ")"
 	case *ast.SelectorExpr:
 		pkg := getTypeName(expr.X)
 		sel := expr.Sel.Name
 		return pkg + "." + sel
+	case *ast.Ellipsis:
+		return "..." + getTypeName(expr.Elt)
 	case *ast.ArrayType:
-		return "[]" + getTypeName(expr.Elt)
+		if expr.Len == nil {
+			return "[]" + getTypeName(expr.Elt)
+		}
+		if _, ok := expr.Len.(*ast.Ellipsis); ok {
+			return "[...]" + getTypeName(expr.Elt)
+		}
+		return "[" + getTypeName(expr.Len) + "]" + getTypeName(expr.Elt)
 	case *ast.MapType:
 		return "map[" + getTypeName(expr.Key) + "]" + getTypeName(expr.Value)
+	case *ast.StructType:
+		return "struct{" + fieldsString(expr.Fields) + "}"
 	case *ast.InterfaceType:
-		return "interface{}"
+		return "interface{" + fieldsString(expr.Methods) + "}"
 	case *ast.ChanType:
-		dir := ""
+		dir := "chan "
 		switch expr.Dir {
 		case ast.RECV:
 			dir = "<-chan "
 		case ast.SEND:
 			dir = "chan<- "
 		}
+		// The parenthesis are required for "chan (<-chan int)".
+		if c, ok := expr.Value.(*ast.ChanType); ok && expr.Dir == ast.SEND|ast.RECV && c.Dir == ast.RECV {
+			return dir + "(" + getTypeName(expr.Value) + ")"
+		}
 		return dir + getTypeName(expr.Value)
 	case *ast.FuncType:
-		// Handle function types if needed
-		// You can recursively call getTypeName for Params and Results
-		return "func"
+		return "func" + signatureString(expr)
+	case *ast.IndexExpr:
+		return getTypeName(expr.X) + "[" + getTypeName(expr.Index) + "]"
+	case *ast.IndexListExpr:
+		indices := make([]string, len(expr.Indices))
+		for i, index := range expr.Indices {
+			indices[i] = getTypeName(index)
+		}
+		return getTypeName(expr.X) + "[" + strings.Join(indices, ", ") + "]"
+	case *ast.UnaryExpr:
+		return expr.Op.String() + getTypeName(expr.X)
+	case *ast.BinaryExpr:
+		return getTypeName(expr.X) + " " + expr.Op.String() + " " + getTypeName(expr.Y)
 	default:
 		return "unknown"
 	}
 }
 
-func convertVarToCamelCaseTo(str string) string {
-	txt := strcase.SnakeCase(str)
-	txt = strings.ReplaceAll(txt, "_", " ")
-	if countWords(txt) < 2 {
-		return ""
+// signatureString returns the parameters and the results of a function type,
+// like "(a, b int, opts ...Option) (*Client, error)".
+func signatureString(fn *ast.FuncType) string {
+	txt := "(" + fieldListString(fn.Params) + ")"
+
+	if fn.Results == nil || len(fn.Results.List) == 0 {
+		return txt
 	}
-	if strings.Contains(txt, "url") {
-		txt = strings.Replace(txt, "url", "", -1)
-		return fmt.Sprintf(" that indicates the endpoint URL for accessing to %s", txt)
+
+	if len(fn.Results.List) == 1 && len(fn.Results.List[0].Names) == 0 {
+		return txt + " " + getTypeName(fn.Results.List[0].Type)
 	}
-	return txt
+
+	return txt + " (" + fieldListString(fn.Results) + ")"
 }
 
-func convertCamelCaseTo(str string) string {
-	txt := strcase.SnakeCase(str)
-	txt = strings.ReplaceAll(txt, "_", " ")
-	if countWords(txt) < 2 {
+// fieldListString returns the comma separated fields of a parameter, result
+// or type parameter list, keeping the grouped names like "a, b int".
+func fieldListString(list *ast.FieldList) string {
+	if list == nil {
 		return ""
 	}
 
-	findPrefix := strings.ToLower(txt)
-
-	if strings.HasPrefix(findPrefix, "get") {
-		return replaceFirstWordGetWithRetrieve(txt)
-
-	} else if strings.HasPrefix(findPrefix, "set") {
-		return replaceFirstWordSetWithRetrieve(txt)
-
-	} else if strings.HasPrefix(findPrefix, "init") {
-		return replaceFirstWordSetWithInitialize(txt)
-
-	} else if strings.HasPrefix(findPrefix, "delete") {
-
-	} else if strings.HasPrefix(findPrefix, "is") {
-		return replaceFirstWordSetWithCheckForIs(txt)
-
-	} else if strings.HasPrefix(findPrefix, "create") {
-
-	} else if strings.HasPrefix(findPrefix, "update") {
-
-	} else if strings.HasPrefix(findPrefix, "has") {
-		return replaceFirstWordSetWithCheckForHas(txt)
-	} else if strings.HasPrefix(findPrefix, "handle") {
-
-	} else if strings.HasPrefix(findPrefix, "process") {
-
-	} else if strings.HasPrefix(findPrefix, "run") {
-
-	} else if strings.HasPrefix(findPrefix, "load") {
-
-	} else if strings.HasPrefix(findPrefix, "save") {
-
-	} else if strings.HasPrefix(findPrefix, "init") {
-
-	} else if strings.HasPrefix(findPrefix, "shutdown") {
-
+	fields := make([]string, len(list.List))
+	for i, field := range list.List {
+		fields[i] = fieldString(field)
 	}
 
-	return " which execute " + txt
+	return strings.Join(fields, ", ")
 }
 
-func replaceFirstWordGetWithRetrieve(phrase string) string {
-	return " that retrieve the" + phrase[3:]
-}
+// fieldsString returns the semicolon separated fields of a struct or the
+// methods of an interface.
+func fieldsString(list *ast.FieldList) string {
+	if list == nil || len(list.List) == 0 {
+		return ""
+	}
 
-func replaceFirstWordSetWithRetrieve(phrase string) string {
-	return " which update the" + phrase[3:]
-}
+	fields := make([]string, len(list.List))
+	for i, field := range list.List {
+		if fn, ok := field.Type.(*ast.FuncType); ok && len(field.Names) == 1 {
+			fields[i] = field.Names[0].Name + signatureString(fn)
+			continue
+		}
 
-func replaceFirstWordSetWithInitialize(phrase string) string {
-	return " to initializes the" + phrase[4:]
-}
+		fields[i] = fieldString(field)
+		if field.Tag != nil {
+			fields[i] += " " + field.Tag.Value
+		}
+	}
 
-func replaceFirstWordSetWithCheckForIs(phrase string) string {
-	return " to check the" + phrase[2:]
+	return " " + strings.Join(fields, "; ") + " "
 }
 
-func replaceFirstWordSetWithCheckForHas(phrase string) string {
-	return " to check the" + phrase[3:]
-}
+// fieldString returns a field with its names, if any, and its type.
+func fieldString(field *ast.Field) string {
+	if len(field.Names) == 0 {
+		return getTypeName(field.Type)
+	}
+
+	names := make([]string, len(field.Names))
+	for i, name := range field.Names {
+		names[i] = name.Name
+	}
 
-func countWords(sentence string) int {
-	words := strings.Fields(sentence)
-	return len(words)
+	return strings.Join(names, ", ") + " " + getTypeName(field.Type)
 }
@@ -0,0 +1,380 @@
+package comments
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sentinelRegexp matches the names of the sentinel errors, like "ErrNotFound",
+// "errClosed" or "io.EOF".
+var sentinelRegexp = regexp.MustCompile(`^(Err|err)[A-Z0-9_]|^EOF$`)
+
+// errorFacts are the error conditions found in the body of a function.
+type errorFacts struct {
+	// Sentinels are the sentinel errors returned, like "ErrNotFound" or "io.EOF".
+	Sentinels []string
+	// Conditions are the conditions of the if statements returning each
+	// sentinel error, like `key == ""`, empty for a return without one.
+	Conditions map[string][]string
+	// Wraps are the calls whose error is wrapped with fmt.Errorf and %w.
+	Wraps []string
+	// Propagates are the calls whose error is returned as is.
+	Propagates []string
+	// Types are the custom error types returned, like "*ValidationError".
+	Types []string
+	// Messages are the messages of the errors created with errors.New or
+	// fmt.Errorf without wrapping.
+	Messages []string
+	// Panics tells whether the function may panic.
+	Panics bool
+}
+
+// analyzeErrors walks the body of fn to find the errors it returns and
+// whether it may panic. The nested function literals are not walked, as
+// their returns and panics are not the ones of fn.
+func (t *typesInfo) analyzeErrors(fn *ast.FuncDecl) errorFacts {
+	var facts errorFacts
+	if fn.Body == nil {
+		return facts
+	}
+
+	errorIndexes := errorResultIndexes(fn.Type)
+
+	// sources are the calls which last assigned the error variables.
+	sources := make(map[string]string)
+
+	// stack are the visited node and the ones enclosing it.
+	var stack []ast.Node
+	params := paramNames(fn)
+
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		if node == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		if _, ok := node.(*ast.FuncLit); ok {
+			return false
+		}
+		stack = append(stack, node)
+
+		switch node := node.(type) {
+		case *ast.AssignStmt:
+			if len(node.Rhs) != 1 {
+				return true
+			}
+			call, ok := node.Rhs[0].(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			for _, lhs := range node.Lhs {
+				if ident, ok := lhs.(*ast.Ident); ok && isErrorVar(ident.Name) {
+					sources[ident.Name] = callName(call)
+				}
+			}
+		case *ast.CallExpr:
+			if ident, ok := node.Fun.(*ast.Ident); ok && ident.Name == "panic" {
+				facts.Panics = true
+			}
+			if name := callName(node); name == "log.Panic" || name == "log.Panicf" || name == "log.Panicln" {
+				facts.Panics = true
+			}
+		case *ast.ReturnStmt:
+			if len(node.Results) != len(errorIndexes.all) {
+				return true
+			}
+			for _, i := range errorIndexes.errors {
+				t.analyzeReturnedError(&facts, node.Results[i], sources, returnCondition(stack, params))
+			}
+		}
+		return true
+	})
+
+	return facts
+}
+
+// maxConditionLength is the length of the longest condition written in the
+// comments, the longer ones being left out.
+const maxConditionLength = 40
+
+// returnCondition returns the condition of the if statement whose body holds
+// the visited return statement, given the stack of the nodes enclosing it, or
+// an empty string if there is none or if it can not be written: too long, or
+// depending on other variables than the parameters of the function.
+func returnCondition(stack []ast.Node, params map[string]bool) string {
+	for i := len(stack) - 1; i > 0; i-- {
+		ifStmt, ok := stack[i-1].(*ast.IfStmt)
+		if !ok || stack[i] != ifStmt.Body {
+			continue
+		}
+		cond := types.ExprString(ifStmt.Cond)
+		if ifStmt.Init != nil || len(cond) > maxConditionLength || !onlyUses(ifStmt.Cond, params) {
+			return ""
+		}
+		return cond
+	}
+	return ""
+}
+
+// paramNames returns the names of the receiver and of the parameters of fn.
+func paramNames(fn *ast.FuncDecl) map[string]bool {
+	names := make(map[string]bool)
+	for _, list := range []*ast.FieldList{fn.Recv, fn.Type.Params} {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			for _, name := range field.Names {
+				names[name.Name] = true
+			}
+		}
+	}
+	return names
+}
+
+// onlyUses reports whether the identifiers of expr are all parameters of the
+// function, predeclared or exported, so that a reader of the doc comment
+// knows them.
+func onlyUses(expr ast.Expr, params map[string]bool) bool {
+	ok := true
+	ast.Inspect(expr, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(node.X, func(node ast.Node) bool {
+				if ident, isIdent := node.(*ast.Ident); isIdent && !knownIdent(ident.Name, params) {
+					ok = false
+				}
+				return ok
+			})
+			return false
+		case *ast.Ident:
+			if !knownIdent(node.Name, params) {
+				ok = false
+			}
+		}
+		return ok
+	})
+	return ok
+}
+
+// knownIdent reports whether name is a parameter, predeclared or exported.
+func knownIdent(name string, params map[string]bool) bool {
+	return params[name] || types.Universe.Lookup(name) != nil || token.IsExported(name)
+}
+
+// addSentinel records the sentinel error name returned under cond.
+func (facts *errorFacts) addSentinel(name, cond string) {
+	facts.Sentinels = appendUnique(facts.Sentinels, name)
+	if facts.Conditions == nil {
+		facts.Conditions = make(map[string][]string)
+	}
+	facts.Conditions[name] = appendUnique(facts.Conditions[name], cond)
+}
+
+// analyzeReturnedError adds to facts the kind of the error expression expr
+// returned by the function under the condition cond.
+func (t *typesInfo) analyzeReturnedError(facts *errorFacts, expr ast.Expr, sources map[string]string, cond string) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		switch {
+		case e.Name == "nil":
+		case sentinelRegexp.MatchString(e.Name):
+			facts.addSentinel(e.Name, cond)
+		case sources[e.Name] != "":
+			facts.Propagates = appendUnique(facts.Propagates, sources[e.Name])
+		}
+	case *ast.SelectorExpr:
+		if sentinelRegexp.MatchString(e.Sel.Name) {
+			facts.addSentinel(getTypeName(e), cond)
+		}
+	case *ast.UnaryExpr:
+		if lit, ok := e.X.(*ast.CompositeLit); ok && e.Op == token.AND {
+			facts.Types = appendUnique(facts.Types, "*"+getTypeName(lit.Type))
+		}
+	case *ast.CompositeLit:
+		facts.Types = appendUnique(facts.Types, getTypeName(e.Type))
+	case *ast.CallExpr:
+		switch name := callName(e); name {
+		case "errors.New":
+			if msg := stringArg(e, 0); msg != "" {
+				facts.Messages = appendUnique(facts.Messages, msg)
+			}
+		case "fmt.Errorf":
+			format := stringArg(e, 0)
+			if !strings.Contains(format, "%w") {
+				if format != "" {
+					facts.Messages = appendUnique(facts.Messages, format)
+				}
+				return
+			}
+
+			for _, arg := range e.Args[1:] {
+				switch a := arg.(type) {
+				case *ast.Ident:
+					if sentinelRegexp.MatchString(a.Name) {
+						facts.addSentinel(a.Name, cond)
+					} else if sources[a.Name] != "" {
+						facts.Wraps = appendUnique(facts.Wraps, sources[a.Name])
+					}
+				case *ast.SelectorExpr:
+					if sentinelRegexp.MatchString(a.Sel.Name) {
+						facts.addSentinel(getTypeName(a), cond)
+					}
+				}
+			}
+		default:
+			// A constructor of a custom error type, like "NewValidationError".
+			if typeName := t.errorType(e); typeName != "" {
+				facts.Types = appendUnique(facts.Types, typeName)
+			}
+		}
+	}
+}
+
+// errorType returns the concrete error type returned by a call, if known:
+// the type resolved in the type-checked mode, or the name of the called
+// constructor like "newParseError" without type information.
+func (t *typesInfo) errorType(call *ast.CallExpr) string {
+	if typ := t.typeOf(call); typ != nil {
+		typeName := t.typeString(call)
+		if typeName == "error" || strings.HasPrefix(typeName, "(") {
+			return ""
+		}
+		return typeName
+	}
+
+	name := callName(call)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+
+	lower := strings.ToLower(name)
+	if strings.HasPrefix(lower, "new") && strings.HasSuffix(lower, "error") && len(name) > len("newerror") {
+		return name[len("new"):]
+	}
+	return ""
+}
+
+// resultIndexes are the positions of the results of a function, once the
+// grouped names are expanded.
+type resultIndexes struct {
+	all    []int
+	errors []int
+}
+
+// errorResultIndexes returns the positions of the error results of fn.
+func errorResultIndexes(fn *ast.FuncType) resultIndexes {
+	var indexes resultIndexes
+	if fn.Results == nil {
+		return indexes
+	}
+
+	for _, res := range fn.Results.List {
+		count := len(res.Names)
+		if count == 0 {
+			count = 1
+		}
+		for j := 0; j < count; j++ {
+			i := len(indexes.all)
+			indexes.all = append(indexes.all, i)
+			if getTypeName(res.Type) == "error" {
+				indexes.errors = append(indexes.errors, i)
+			}
+		}
+	}
+
+	return indexes
+}
+
+// isErrorVar tells whether name is the name of an error variable, like "err"
+// or "readErr", rather than a sentinel error.
+func isErrorVar(name string) bool {
+	return name == "err" || strings.HasSuffix(name, "Err")
+}
+
+// callName returns the name of the called function, like "os.Open" or
+// "s.store.Get", or an empty string for the other calls.
+func callName(call *ast.CallExpr) string {
+	name := getTypeName(call.Fun)
+	if strings.Contains(name, "unknown") {
+		return ""
+	}
+	return name
+}
+
+// stringArg returns the value of the i-th argument of call if it is a string
+// literal.
+func stringArg(call *ast.CallExpr, i int) string {
+	if len(call.Args) <= i {
+		return ""
+	}
+	lit, ok := call.Args[i].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return ""
+	}
+	value, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// appendUnique appends value to values if it is not already there.
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// panicSentence is the sentence of describe for the functions which may panic.
+const panicSentence = "It may panic."
+
+// describe returns the sentences describing the error conditions, or nil if
+// nothing was found. A sentinel error returned under one or two conditions is
+// described with them, like `It returns ErrEmpty if key == "".`.
+func (facts errorFacts) describe() []string {
+	var (
+		sentences []string
+		others    []string
+	)
+
+	for _, sentinel := range facts.Sentinels {
+		conds := facts.Conditions[sentinel]
+		if len(conds) == 0 || len(conds) > 2 || slices.Contains(conds, "") {
+			others = append(others, sentinel)
+			continue
+		}
+		sentences = append(sentences, "It returns "+sentinel+" if "+strings.Join(conds, " or ")+".")
+	}
+	if len(others) > 0 {
+		sentences = append(sentences, "It may return "+joinAlternatives(others)+".")
+	}
+	if len(facts.Types) > 0 {
+		sentences = append(sentences, "It returns errors of type "+joinAlternatives(facts.Types)+".")
+	}
+	if len(facts.Wraps) > 0 {
+		sentences = append(sentences, "It wraps the errors returned by "+joinWords(facts.Wraps)+".")
+	}
+	if len(facts.Propagates) > 0 {
+		sentences = append(sentences, "It returns the errors of "+joinWords(facts.Propagates)+" as is.")
+	}
+	if len(facts.Messages) > 0 {
+		quoted := make([]string, len(facts.Messages))
+		for i, msg := range facts.Messages {
+			quoted[i] = strconv.Quote(msg)
+		}
+		sentences = append(sentences, "It fails with "+joinAlternatives(quoted)+".")
+	}
+	if facts.Panics {
+		sentences = append(sentences, panicSentence)
+	}
+
+	return sentences
+}
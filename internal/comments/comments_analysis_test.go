@@ -0,0 +1,133 @@
+package comments
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "no error",
+			src:  "func Foo(x int) int { return x }",
+		},
+		{
+			name: "sentinel under a condition",
+			src: `func Get(key string) (string, error) {
+	if key == "" {
+		return "", ErrEmptyKey
+	}
+	return key, nil
+}`,
+			want: []string{`It returns ErrEmptyKey if key == "".`},
+		},
+		{
+			name: "sentinel under two conditions",
+			src: `func Get(key string, n int) error {
+	if key == "" {
+		return ErrInvalid
+	}
+	if n > MaxSize {
+		return ErrInvalid
+	}
+	return nil
+}`,
+			want: []string{`It returns ErrInvalid if key == "" or n > MaxSize.`},
+		},
+		{
+			name: "condition on a local variable",
+			src: `func Read(r io.Reader) error {
+	n := count(r)
+	if n == 0 {
+		return io.EOF
+	}
+	return nil
+}`,
+			want: []string{"It may return io.EOF."},
+		},
+		{
+			name: "condition with an init statement",
+			src: `func Check(s string) error {
+	if err := validate(s); err != nil {
+		return ErrInvalid
+	}
+	return nil
+}`,
+			want: []string{"It may return ErrInvalid."},
+		},
+		{
+			name: "sentinels with and without a condition",
+			src: `func Next(i int) (int, error) {
+	if i < 0 {
+		return 0, ErrNegative
+	}
+	switch i {
+	case 0:
+		return 0, ErrNegative
+	case 1:
+		return 0, ErrDone
+	}
+	return i, nil
+}`,
+			want: []string{"It may return ErrNegative or ErrDone."},
+		},
+		{
+			name: "wrapped and propagated errors",
+			src: `func Load(name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("load %s: %w", name, err)
+	}
+	err = json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	return nil
+}`,
+			want: []string{
+				"It wraps the errors returned by os.ReadFile.",
+				"It returns the errors of json.Unmarshal as is.",
+			},
+		},
+		{
+			name: "message and panic",
+			src: `func Must(ok bool) error {
+	if !ok {
+		panic("not ok")
+	}
+	return errors.New("failed")
+}`,
+			want: []string{`It fails with "failed".`, panicSentence},
+		},
+		{
+			name: "function literal ignored",
+			src: `func Run() error {
+	fn := func() error { return ErrInner }
+	_ = fn
+	return nil
+}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parser.ParseFile(token.NewFileSet(), "a.go", "package a\n\n"+tt.src+"\n", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var types *typesInfo
+			got := types.analyzeErrors(f.Decls[0].(*ast.FuncDecl)).describe()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("describe() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
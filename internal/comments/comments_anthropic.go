@@ -2,118 +2,325 @@ package comments
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"go/ast"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ariden/gocomments/provider"
 )
 
-func newAnthropic() commentsProcess {
-	return &anthropic{}
-}
+// The defaults of the Anthropic provider.
+const (
+	defaultAnthropicURL       = "https://api.anthropic.com"
+	defaultAnthropicModel     = "claude-haiku-4-5"
+	defaultAnthropicMaxTokens = 300
+	anthropicVersion          = "2023-06-01"
+	bedrockAnthropicVersion   = "bedrock-2023-05-31"
+)
+
+// defaultSystemPrompt is the system prompt of the AI providers, asking for
+// the raw text of the comment.
+const defaultSystemPrompt = "You write the doc comments of Go declarations for other developers. " +
+	"Answer with the text of the comment only, starting with the name of the declaration, " +
+	"without the // prefixes, code fences or any markdown."
 
 type AnthropicConfig struct {
 	// Do we use Anthropic Claude to generate function comments
-	Active       *bool   `yaml:"active"`
-	URL          string  `yaml:"url"`
-	SSORegion    *string `yaml:"sso-region"`
-	AccessKey    *string `yaml:"access-key"`
-	SecretKey    *string `yaml:"secret-key"`
-	SessionToken *string `yaml:"session-token"`
+	Active *bool `yaml:"active"`
+	// URL is the base URL of the Messages API, https://api.anthropic.com by
+	// default. The path from /v1 on is removed, so that the URL of an API
+	// endpoint, like https://api.anthropic.com/v1/messages, gives its base
+	// URL. In the Bedrock mode, it is the Bedrock runtime endpoint,
+	// https://bedrock-runtime.<region>.amazonaws.com by default.
+	URL string `yaml:"url"`
+	// APIKey is the key sent in the x-api-key header. The ANTHROPIC_API_KEY
+	// environment variable is used when it is not set.
+	APIKey *string `yaml:"api-key"`
+	// Model is the name of the model, or its model ID in the Bedrock mode.
+	Model     string `yaml:"model"`
+	MaxTokens int    `yaml:"max-tokens"`
+	// System is the system prompt of the requests.
+	System string `yaml:"system"`
+	// Bedrock calls the model through Amazon Bedrock, with requests signed
+	// with the AWS credentials below instead of an API key.
+	Bedrock      *bool      `yaml:"bedrock"`
+	SSORegion    *string    `yaml:"sso-region"`
+	AccessKey    *string    `yaml:"access-key"`
+	SecretKey    *string    `yaml:"secret-key"`
+	SessionToken *string    `yaml:"session-token"`
+	HTTP         HTTPConfig `yaml:"http"`
+}
+
+// Merge returns the configuration overridden by the values set in newCfg.
+func (cfg AnthropicConfig) Merge(newCfg AnthropicConfig) AnthropicConfig {
+	if newCfg.Active != nil {
+		cfg.Active = newCfg.Active
+	}
+	if newCfg.URL != "" {
+		cfg.URL = newCfg.URL
+	}
+	if newCfg.APIKey != nil {
+		cfg.APIKey = newCfg.APIKey
+	}
+	if newCfg.Model != "" {
+		cfg.Model = newCfg.Model
+	}
+	if newCfg.MaxTokens != 0 {
+		cfg.MaxTokens = newCfg.MaxTokens
+	}
+	if newCfg.System != "" {
+		cfg.System = newCfg.System
+	}
+	if newCfg.Bedrock != nil {
+		cfg.Bedrock = newCfg.Bedrock
+	}
+	if newCfg.SSORegion != nil {
+		cfg.SSORegion = newCfg.SSORegion
+	}
+	if newCfg.AccessKey != nil {
+		cfg.AccessKey = newCfg.AccessKey
+	}
+	if newCfg.SecretKey != nil {
+		cfg.SecretKey = newCfg.SecretKey
+	}
+	if newCfg.SessionToken != nil {
+		cfg.SessionToken = newCfg.SessionToken
+	}
+	cfg.HTTP = cfg.HTTP.Merge(newCfg.HTTP)
+	return cfg
 }
 
 type anthropic struct {
 	AnthropicConfig
+	defaultProcess
+	client *httpClient
 }
 
 func (a *anthropic) isActive() bool {
-	if a.Active == nil || *a.Active == false {
-		return false
+	return a.Active != nil && *a.Active
+}
+
+func (a *anthropic) isBedrock() bool {
+	return a.Bedrock != nil && *a.Bedrock
+}
+
+func (a *anthropic) checkConfig() error {
+	if a.MaxTokens == 0 {
+		a.MaxTokens = defaultAnthropicMaxTokens
+	}
+	if a.System == "" {
+		a.System = defaultSystemPrompt
+	}
+
+	if a.isBedrock() {
+		if a.SSORegion == nil || *a.SSORegion == "" {
+			return errors.New("please set your AWS region in the anthropic-sso-region variable")
+		}
+		if a.AccessKey == nil || *a.AccessKey == "" || a.SecretKey == nil || *a.SecretKey == "" {
+			return errors.New("please set your AWS credentials in the anthropic-access-key and anthropic-secret-key variables")
+		}
+		if a.Model == "" {
+			return errors.New("please set the Bedrock model ID in the anthropic-model variable")
+		}
+		if a.URL == "" {
+			a.URL = "https://bedrock-runtime." + *a.SSORegion + ".amazonaws.com"
+		}
+		return nil
+	}
+
+	if a.APIKey == nil || *a.APIKey == "" {
+		apiKey := os.Getenv("ANTHROPIC_API_KEY")
+		if apiKey == "" {
+			return errors.New("please set your Anthropic API key in the anthropic-api-key variable or in ANTHROPIC_API_KEY")
+		}
+		a.APIKey = &apiKey
+	}
+	if a.Model == "" {
+		a.Model = defaultAnthropicModel
 	}
 	if a.URL == "" {
-		log.Fatal("Please set your AWS SSO Region in the anthropic-url variable.")
+		a.URL = defaultAnthropicURL
 	}
-	if a.AccessKey == nil || *a.AccessKey == "" {
-		log.Fatal("Please set your AWS SSO Region in the anthropic-access-key variable.")
+
+	baseURL, err := anthropicBaseURL(a.URL)
+	if err != nil {
+		return err
 	}
-	return true
+	a.URL = baseURL
+	return nil
 }
 
-func (a *anthropic) commentFunc(fn *ast.FuncDecl) (string, error) {
-	functionCode := GenerateFuncCode(fn)
-	var funcComment string
+// anthropicBaseURL returns the base URL of the Messages API from rawURL,
+// without its path from /v1 on, like https://api.anthropic.com for
+// https://api.anthropic.com/v1/complete.
+func anthropicBaseURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid URL %q in the anthropic-url variable", rawURL)
+	}
 
-	payload := RequestPayload{
-		Prompt:      fmt.Sprintf("Generate a detailed comment in English for the following Go function:\n%s", functionCode),
-		MaxTokens:   150,
-		Model:       "claude-v1",
-		Temperature: 0.7,
+	if i := strings.Index(u.Path+"/", "/v1/"); i >= 0 {
+		u.Path = u.Path[:i]
 	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
 
-	// Convert payload to JSON
-	payloadBytes, err := json.Marshal(payload)
+// Name returns the name of the Anthropic provider.
+func (a *anthropic) Name() string {
+	return "anthropic"
+}
+
+func (a *anthropic) cacheModel() modelInfo {
+	info := modelInfo{
+		Model:    a.Model,
+		Version:  anthropicVersion,
+		Settings: []string{a.System, strconv.Itoa(a.MaxTokens)},
+	}
+	if a.isBedrock() {
+		info.Version = bedrockAnthropicVersion
+	}
+	return info
+}
+
+// Comment generates the comments of the functions with the Anthropic model,
+// and the comments of the other declarations offline.
+func (a *anthropic) Comment(ctx context.Context, decls []provider.Decl) ([]provider.Comment, error) {
+	return commentDecls(ctx, a, decls, a.jobs)
+}
+
+func (a *anthropic) commentPrompt(ctx context.Context, prompt string) (provider.Comment, error) {
+	txt, err := a.callAnthropic(ctx, prompt)
 	if err != nil {
-		return funcComment, fmt.Errorf("error marshalling payload: %v", err)
+		return provider.Comment{}, err
+	}
+	return parseComment(txt), nil
+}
+
+// anthropicMessage is a message of the Messages API.
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// anthropicRequest is the body of a Messages API request. The model is given
+// in the URL of the Bedrock requests, which set the API version instead.
+type anthropicRequest struct {
+	Model            string             `json:"model,omitempty"`
+	AnthropicVersion string             `json:"anthropic_version,omitempty"`
+	MaxTokens        int                `json:"max_tokens"`
+	System           string             `json:"system,omitempty"`
+	Messages         []anthropicMessage `json:"messages"`
+}
+
+// anthropicResponse is the body of a Messages API response.
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Error      *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// callAnthropic sends prompt to the Messages API and returns the text of the
+// answer.
+func (a *anthropic) callAnthropic(ctx context.Context, prompt string) (string, error) {
+	payload := anthropicRequest{
+		MaxTokens: a.MaxTokens,
+		System:    a.System,
+		Messages:  []anthropicMessage{{Role: "user", Content: prompt}},
+	}
+
+	endpoint := strings.TrimSuffix(a.URL, "/")
+	if a.isBedrock() {
+		payload.AnthropicVersion = bedrockAnthropicVersion
+		endpoint += "/model/" + awsEscape(a.Model) + "/invoke"
+	} else {
+		payload.Model = a.Model
+		endpoint += "/v1/messages"
 	}
 
-	// Create a new HTTP request
-	req, err := http.NewRequest("POST", a.URL, bytes.NewBuffer(payloadBytes))
+	body, err := json.Marshal(payload)
 	if err != nil {
-		return funcComment, fmt.Errorf("error creating request: %v", err)
+		return "", fmt.Errorf("error marshalling payload: %v", err)
 	}
 
-	// Set the appropriate headers
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.AccessKey))
 
-	// Make the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	if a.isBedrock() {
+		var sessionToken string
+		if a.SessionToken != nil {
+			sessionToken = *a.SessionToken
+		}
+		signV4(req, body, awsCredentials{
+			accessKey:    *a.AccessKey,
+			secretKey:    *a.SecretKey,
+			sessionToken: sessionToken,
+			region:       *a.SSORegion,
+			service:      "bedrock",
+		}, time.Now())
+	} else {
+		req.Header.Set("x-api-key", *a.APIKey)
+		req.Header.Set("anthropic-version", anthropicVersion)
+	}
+
+	resp, err := a.client.do(ctx, req)
 	if err != nil {
-		return funcComment, fmt.Errorf("error making request: %v", err)
+		return "", fmt.Errorf("error making request: %v", err)
 	}
 	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
+		if err := Body.Close(); err != nil {
 			log.Println("fail to close reader")
 		}
 	}(resp.Body)
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return funcComment, fmt.Errorf("error reading response body: %v", err)
+		return "", fmt.Errorf("error reading response body: %v", err)
 	}
 
-	// Check if the request was successful
-	if resp.StatusCode != http.StatusOK {
-		return funcComment, fmt.Errorf("request failed with status %d: %s\n", resp.StatusCode, string(body))
+	var response anthropicResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("request failed with status %d: %s", resp.StatusCode, respBody)
+		}
+		return "", fmt.Errorf("error unmarshalling response: %v", err)
 	}
 
-	// Parse the response
-	var responsePayload ResponsePayload
-	err = json.Unmarshal(body, &responsePayload)
-	if err != nil {
-		return funcComment, fmt.Errorf("error unmarshalling response: %v", err)
+	if resp.StatusCode != http.StatusOK {
+		if response.Error != nil {
+			return "", fmt.Errorf("request failed with status %d: %s: %s", resp.StatusCode, response.Error.Type, response.Error.Message)
+		}
+		return "", fmt.Errorf("request failed with status %d: %s", resp.StatusCode, respBody)
 	}
 
-	// Print the response
-	return responsePayload.Completion, nil
-}
-
-func (a *anthropic) commentConst(string, bool) (string, error) {
-	var constComment string
-	return constComment, nil
-}
-
-func (a *anthropic) commentVar(name, declType, explainVar string, exported bool) (string, error) {
-	var varComment string
-	return varComment, nil
-}
+	var text strings.Builder
+	for _, block := range response.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if strings.TrimSpace(text.String()) == "" {
+		return "", fmt.Errorf("no text in the response, stop reason %q", response.StopReason)
+	}
 
-func (a *anthropic) commentType(genDecl *ast.GenDecl) (string, error) {
-	var typeComment string
-	return typeComment, nil
+	return cleanComment(text.String()), nil
 }
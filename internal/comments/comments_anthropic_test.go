@@ -0,0 +1,179 @@
+package comments
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnthropicBaseURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{url: "https://api.anthropic.com", want: "https://api.anthropic.com"},
+		{url: "https://api.anthropic.com/", want: "https://api.anthropic.com"},
+		{url: "https://api.anthropic.com/v1", want: "https://api.anthropic.com"},
+		{url: "https://api.anthropic.com/v1/complete", want: "https://api.anthropic.com"},
+		{url: "https://api.anthropic.com/v1/messages", want: "https://api.anthropic.com"},
+		{url: "https://proxy.example.com/anthropic/v1/messages", want: "https://proxy.example.com/anthropic"},
+		{url: "http://localhost:8080/v10", want: "http://localhost:8080/v10"},
+		{url: "api.anthropic.com", wantErr: true},
+		{url: "://", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := anthropicBaseURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("anthropicBaseURL() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("anthropicBaseURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// anthropicServer is a test server of the Messages API answering with
+// answer, and recording the last request and its body.
+func anthropicServer(t *testing.T, answer string) (*httptest.Server, *http.Request, *anthropicRequest) {
+	t.Helper()
+
+	var (
+		request = new(http.Request)
+		body    = new(anthropicRequest)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*request = *r.Clone(context.Background())
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, body); err != nil {
+			t.Errorf("invalid request body %s: %v", data, err)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"content":     []interface{}{map[string]string{"type": "text", "text": answer}},
+			"stop_reason": "end_turn",
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, request, body
+}
+
+func TestAnthropicRequest(t *testing.T) {
+	server, request, body := anthropicServer(t, "Foo does foo.\nIt returns nothing.")
+
+	apiKey := "sk-test"
+	a := &anthropic{
+		AnthropicConfig: AnthropicConfig{
+			URL:    server.URL + "/v1/complete",
+			APIKey: &apiKey,
+		},
+		client: newHTTPClient("anthropic", server.URL, HTTPConfig{}),
+	}
+	if err := a.checkConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	comment, err := a.commentPrompt(context.Background(), "Comment Foo.")
+	if err != nil {
+		t.Fatalf("commentPrompt() error = %v", err)
+	}
+	if got, want := comment.Text(), "Foo does foo.\nIt returns nothing."; got != want {
+		t.Errorf("commentPrompt() = %q, want %q", got, want)
+	}
+
+	if request.URL.Path != "/v1/messages" {
+		t.Errorf("path = %q, want /v1/messages", request.URL.Path)
+	}
+	for name, want := range map[string]string{
+		"Content-Type":      "application/json",
+		"X-Api-Key":         "sk-test",
+		"Anthropic-Version": anthropicVersion,
+	} {
+		if got := request.Header.Get(name); got != want {
+			t.Errorf("header %s = %q, want %q", name, got, want)
+		}
+	}
+
+	want := anthropicRequest{
+		Model:     defaultAnthropicModel,
+		MaxTokens: defaultAnthropicMaxTokens,
+		System:    defaultSystemPrompt,
+		Messages:  []anthropicMessage{{Role: "user", Content: "Comment Foo."}},
+	}
+	if !reflect.DeepEqual(*body, want) {
+		t.Errorf("body = %+v, want %+v", *body, want)
+	}
+}
+
+func TestAnthropicBedrockRequest(t *testing.T) {
+	server, request, body := anthropicServer(t, "Foo does foo.")
+
+	region, accessKey, secretKey, token := "us-east-1", "AKIDEXAMPLE", "secret", "token"
+	bedrock := true
+	a := &anthropic{
+		AnthropicConfig: AnthropicConfig{
+			URL:          server.URL,
+			Model:        "anthropic.claude:0",
+			Bedrock:      &bedrock,
+			SSORegion:    &region,
+			AccessKey:    &accessKey,
+			SecretKey:    &secretKey,
+			SessionToken: &token,
+		},
+		client: newHTTPClient("anthropic", server.URL, HTTPConfig{}),
+	}
+	if err := a.checkConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.commentPrompt(context.Background(), "Comment Foo."); err != nil {
+		t.Fatalf("commentPrompt() error = %v", err)
+	}
+
+	if got, want := request.URL.EscapedPath(), "/model/anthropic.claude%3A0/invoke"; got != want {
+		t.Errorf("path = %q, want %q", got, want)
+	}
+	auth := request.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/us-east-1/bedrock/aws4_request") {
+		t.Errorf("Authorization = %q, want a SigV4 signature of bedrock in us-east-1", auth)
+	}
+	if got := request.Header.Get("X-Amz-Security-Token"); got != token {
+		t.Errorf("X-Amz-Security-Token = %q, want %q", got, token)
+	}
+	if request.Header.Get("X-Api-Key") != "" {
+		t.Error("x-api-key sent to Bedrock")
+	}
+	if body.Model != "" || body.AnthropicVersion != bedrockAnthropicVersion {
+		t.Errorf("body model %q and version %q, want no model and %q", body.Model, body.AnthropicVersion, bedrockAnthropicVersion)
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case of the AWS Signature Version 4 test suite.
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signV4(req, nil, awsCredentials{
+		accessKey: "AKIDEXAMPLE",
+		secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		region:    "us-east-1",
+		service:   "service",
+	}, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,459 @@
+package comments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ariden/gocomments/provider"
+)
+
+// cacheFormat is the version of the cache keys and entries. Changing it
+// invalidates the entries written by the previous versions.
+const cacheFormat = 1
+
+// DefaultCacheDir returns the directory of the response cache under the user
+// cache directory, like ~/.cache/gocomments on Linux.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gocomments"), nil
+}
+
+// ResponseCache stores on disk the comments generated by the AI providers,
+// so that a declaration which did not change is not sent again to the
+// same model with the same prompt. Each entry is a file named after the
+// hash of its key. It is safe for concurrent use, also by several runs.
+type ResponseCache struct {
+	dir string
+
+	openOnce sync.Once
+	openErr  error
+}
+
+// OpenResponseCache returns the cache stored in dir, creating dir if needed.
+func OpenResponseCache(dir string) (*ResponseCache, error) {
+	c := &ResponseCache{dir: dir}
+	c.openOnce.Do(func() {
+		c.openErr = c.createDir()
+	})
+	if c.openErr != nil {
+		return nil, c.openErr
+	}
+	return c, nil
+}
+
+// NewResponseCache returns the cache stored in dir, or in DefaultCacheDir
+// when dir is empty. Unlike OpenResponseCache, nothing is done before a
+// provider of a chain uses the cache: the runs without AI provider don't
+// touch the disk, and a cache which can't be opened is disabled with a
+// warning instead of failing the run.
+func NewResponseCache(dir string) *ResponseCache {
+	return &ResponseCache{dir: dir}
+}
+
+// open opens the cache on its first call and tells whether it can be used.
+func (c *ResponseCache) open() bool {
+	c.openOnce.Do(func() {
+		if c.dir == "" {
+			if c.dir, c.openErr = DefaultCacheDir(); c.openErr != nil {
+				c.openErr = fmt.Errorf("fail to find the cache directory: %v", c.openErr)
+			}
+		}
+		if c.openErr == nil {
+			c.openErr = c.createDir()
+		}
+		if c.openErr != nil {
+			log.Printf("warning: the comments are not cached: %v", c.openErr)
+		}
+	})
+	return c.openErr == nil
+}
+
+// exists tells whether the directory of the cache exists, without creating
+// it.
+func (c *ResponseCache) exists() bool {
+	dir := c.dir
+	if dir == "" {
+		var err error
+		if dir, err = DefaultCacheDir(); err != nil {
+			return false
+		}
+	}
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// createDir creates the directory of the cache if needed.
+func (c *ResponseCache) createDir() error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("fail to create the cache directory: %v", err)
+	}
+	return nil
+}
+
+// Dir returns the directory of the cache.
+func (c *ResponseCache) Dir() string {
+	return c.dir
+}
+
+// cacheEntry is the content of a cache file.
+type cacheEntry struct {
+	Provider string           `json:"provider"`
+	Model    string           `json:"model,omitempty"`
+	Created  time.Time        `json:"created"`
+	Comment  provider.Comment `json:"comment"`
+}
+
+// path returns the path of the entry of key, in a subdirectory named after
+// its first two characters to keep the directories small.
+func (c *ResponseCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// get returns the cached comment of key. A hit updates the modification
+// time of the entry, which is the last use pruned by Prune.
+func (c *ResponseCache) get(key string) (provider.Comment, bool) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return provider.Comment{}, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Comment.IsZero() {
+		return provider.Comment{}, false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return entry.Comment, true
+}
+
+// put stores the comment of key. The entry is written to a temporary file
+// renamed in place, so that a concurrent run never reads a partial entry.
+func (c *ResponseCache) put(key string, entry cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := writeTempFile(filepath.Dir(path), data)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeTempFile writes data to a new temporary file of dir.
+func writeTempFile(dir string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// CacheStats are the statistics of the entries of a cache.
+type CacheStats struct {
+	Dir     string
+	Entries int
+	// Size is the size of the entries in bytes.
+	Size int64
+	// Oldest and Newest are the oldest and the newest last use of an entry.
+	Oldest time.Time
+	Newest time.Time
+	// Providers are the number of entries of each provider and model, like
+	// "openai gpt-4o-mini".
+	Providers map[string]int
+}
+
+// String returns the multi-line representation of the statistics.
+func (s CacheStats) String() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "directory: %s\n", s.Dir)
+	_, _ = fmt.Fprintf(&b, "entries:   %d (%s)\n", s.Entries, formatSize(s.Size))
+	if s.Entries > 0 {
+		_, _ = fmt.Fprintf(&b, "oldest:    %s\n", s.Oldest.Format(time.DateTime))
+		_, _ = fmt.Fprintf(&b, "newest:    %s\n", s.Newest.Format(time.DateTime))
+	}
+
+	names := make([]string, 0, len(s.Providers))
+	for name := range s.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(&b, "  %s: %d\n", name, s.Providers[name])
+	}
+	return b.String()
+}
+
+// formatSize returns a size in bytes in a human readable form, like "12.3 KiB".
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return strconv.FormatInt(size, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Stats reads all the entries of the cache.
+func (c *ResponseCache) Stats() (CacheStats, error) {
+	stats := CacheStats{Dir: c.dir, Providers: make(map[string]int)}
+
+	err := c.walk(func(path string, info fs.FileInfo) error {
+		stats.Entries++
+		stats.Size += info.Size()
+		if stats.Oldest.IsZero() || info.ModTime().Before(stats.Oldest) {
+			stats.Oldest = info.ModTime()
+		}
+		if info.ModTime().After(stats.Newest) {
+			stats.Newest = info.ModTime()
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var entry cacheEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			stats.Providers["invalid"]++
+			return nil
+		}
+		stats.Providers[strings.TrimSpace(entry.Provider+" "+entry.Model)]++
+		return nil
+	})
+	return stats, err
+}
+
+// Prune removes the entries not used for more than maxAge, or all of them
+// when maxAge is 0. It returns the number of entries removed and the bytes
+// freed.
+func (c *ResponseCache) Prune(maxAge time.Duration) (int, int64, error) {
+	var (
+		removed int
+		freed   int64
+		limit   = time.Now().Add(-maxAge)
+	)
+	err := c.walk(func(path string, info fs.FileInfo) error {
+		if maxAge > 0 && info.ModTime().After(limit) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		freed += info.Size()
+		return nil
+	})
+	return removed, freed, err
+}
+
+// walk calls fn for each entry of the cache.
+func (c *ResponseCache) walk(fn func(path string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(path, info)
+	})
+}
+
+// modelInfo describes the model behind a provider, for the cache keys.
+type modelInfo struct {
+	Model   string
+	Version string
+	// Settings are the other settings changing the answers, like the system
+	// prompt or the temperature.
+	Settings []string
+}
+
+// cacheModeler is implemented by the providers whose comments depend on a
+// model, so that changing the model or its settings misses the cache.
+type cacheModeler interface {
+	cacheModel() modelInfo
+}
+
+// cachedProvider is a provider whose comments are read from the cache, only
+// the declarations missing from it being sent to the provider, or none of
+// them when offline.
+type cachedProvider struct {
+	provider.Provider
+	cache   *ResponseCache
+	model   modelInfo
+	prompts PromptConfig
+	offline bool
+}
+
+// newCachedProvider returns p with its comments cached in cache.
+func newCachedProvider(p provider.Provider, cache *ResponseCache, prompts PromptConfig) *cachedProvider {
+	cp := &cachedProvider{Provider: p, cache: cache, prompts: prompts}
+	if m, ok := p.(cacheModeler); ok {
+		cp.model = m.cacheModel()
+	}
+	return cp
+}
+
+// cacheable tells whether the comment of decl is generated by the model of
+// the provider. The built-in AI providers comment the functions and the
+// declarations having a prompt with their model, and the other ones
+// offline.
+func (p *cachedProvider) cacheable(decl provider.Decl) bool {
+	if _, ok := p.Provider.(declCommenter); !ok {
+		return true
+	}
+	if decl.Kind == provider.KindFunc || decl.Kind == provider.KindMethod {
+		return true
+	}
+	_, ok := p.Provider.(promptCommenter)
+	return ok && decl.Prompt != ""
+}
+
+// cacheKey is hashed into the key of a cache entry.
+type cacheKey struct {
+	Format   int           `json:"format"`
+	Provider string        `json:"provider"`
+	Model    string        `json:"model"`
+	Version  string        `json:"version"`
+	Settings []string      `json:"settings"`
+	Template string        `json:"template"`
+	Decl     provider.Decl `json:"decl"`
+}
+
+// key returns the key of the comment of decl: the hash of the provider, its
+// model, the prompt template of the kind of decl and the descriptor of
+// decl, which holds its source and its rendered prompt. The file of decl is
+// left out, so that moving a declaration keeps its entry.
+func (p *cachedProvider) key(decl provider.Decl) string {
+	decl.File = ""
+	data, err := json.Marshal(cacheKey{
+		Format:   cacheFormat,
+		Provider: p.Name(),
+		Model:    p.model.Model,
+		Version:  p.model.Version,
+		Settings: p.model.Settings,
+		Template: p.prompts.template(decl.Kind),
+		Decl:     decl,
+	})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Comment returns the cached comments of decls and sends the other ones to
+// the provider, caching its comments. The cached comments are kept when the
+// provider fails, the other declarations being left to the next provider.
+func (p *cachedProvider) Comment(ctx context.Context, decls []provider.Decl) ([]provider.Comment, error) {
+	comments := make([]provider.Comment, len(decls))
+	keys := make([]string, len(decls))
+
+	var (
+		missing []provider.Decl
+		indexes []int
+		hits    int
+	)
+	for i, decl := range decls {
+		if p.cacheable(decl) {
+			keys[i] = p.key(decl)
+		}
+		if keys[i] != "" {
+			if comment, ok := p.cache.get(keys[i]); ok {
+				comments[i] = comment
+				hits++
+				continue
+			}
+		}
+		missing = append(missing, decl)
+		indexes = append(indexes, i)
+	}
+	if len(missing) == 0 || p.offline {
+		return comments, nil
+	}
+
+	results, err := p.Provider.Comment(ctx, missing)
+	if err == nil && len(results) != len(missing) {
+		err = fmt.Errorf("%d comments returned for %d declarations", len(results), len(missing))
+	}
+	if err != nil {
+		if hits == 0 || ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("fail to generate comments with the %s provider, keeping the cached ones: %v", p.Name(), err)
+		return comments, nil
+	}
+
+	for j, i := range indexes {
+		comments[i] = results[j]
+		if keys[i] == "" || results[j].IsZero() {
+			continue
+		}
+		entry := cacheEntry{
+			Provider: p.Name(),
+			Model:    p.model.Model,
+			Created:  time.Now(),
+			Comment:  results[j],
+		}
+		if err := p.cache.put(keys[i], entry); err != nil {
+			log.Printf("fail to cache the comment of %s %s: %v", decls[i].Kind, decls[i].Name, err)
+		}
+	}
+	return comments, nil
+}
+
+// formatFloat returns an optional setting as a string, empty when unset.
+func formatFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'g', -1, 64)
+}
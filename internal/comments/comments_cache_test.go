@@ -0,0 +1,241 @@
+package comments
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ariden/gocomments/provider"
+)
+
+func TestResponseCacheOpenedByProviders(t *testing.T) {
+	active := true
+	blocked := filepath.Join(t.TempDir(), "file")
+	writeTestFile(t, blocked, "")
+
+	tests := []struct {
+		name       string
+		cfg        CommentConfig
+		dir        string
+		wantDir    bool
+		wantCached bool
+	}{
+		{
+			name: "no AI provider",
+			dir:  filepath.Join(t.TempDir(), "cache"),
+		},
+		{
+			name:       "AI provider",
+			cfg:        CommentConfig{Ollama: OllamaConfig{Active: &active, Model: "llama3"}},
+			dir:        filepath.Join(t.TempDir(), "cache"),
+			wantDir:    true,
+			wantCached: true,
+		},
+		{
+			name: "AI provider after the default one",
+			cfg: CommentConfig{
+				Providers: []string{"default", "ollama"},
+				Ollama:    OllamaConfig{Model: "llama3"},
+			},
+			dir: filepath.Join(t.TempDir(), "cache"),
+		},
+		{
+			name: "cache not opened",
+			cfg:  CommentConfig{Ollama: OllamaConfig{Active: &active, Model: "llama3"}},
+			dir:  filepath.Join(blocked, "cache"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := newProviderChain(&tt.cfg, nil, Options{Jobs: 1, Cache: NewResponseCache(tt.dir)})
+			if err != nil {
+				t.Fatalf("newProviderChain() error = %v", err)
+			}
+
+			if _, err := os.Stat(tt.dir); (err == nil) != tt.wantDir {
+				t.Errorf("cache directory created = %v, want %v", err == nil, tt.wantDir)
+			}
+			_, cached := chain.providers[0].(*cachedProvider)
+			if cached != tt.wantCached {
+				t.Errorf("first provider cached = %v, want %v", cached, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestOfflineProviderChain(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request sent offline to %s", r.URL)
+	}))
+	t.Cleanup(server.Close)
+
+	active := true
+	apiKey := "sk-test"
+	valid := CommentConfig{Anthropic: AnthropicConfig{Active: &active, URL: server.URL, APIKey: &apiKey}}
+
+	tests := []struct {
+		name      string
+		cfg       CommentConfig
+		dir       string
+		cached    bool
+		wantNames []string
+		want      string
+	}{
+		{
+			name:      "no cache directory",
+			cfg:       valid,
+			dir:       filepath.Join(t.TempDir(), "cache"),
+			wantNames: []string{"default"},
+			want:      "default",
+		},
+		{
+			name:      "existing cache directory",
+			cfg:       valid,
+			dir:       t.TempDir(),
+			wantNames: []string{"anthropic", "default"},
+			want:      "default",
+		},
+		{
+			name:      "cached comment",
+			cfg:       valid,
+			dir:       t.TempDir(),
+			cached:    true,
+			wantNames: []string{"anthropic", "default"},
+			want:      "anthropic",
+		},
+		{
+			name:      "invalid configuration",
+			cfg:       CommentConfig{Anthropic: AnthropicConfig{Active: &active}},
+			dir:       t.TempDir(),
+			wantNames: []string{"default"},
+			want:      "default",
+		},
+	}
+
+	file := newTestFile(t, testModule(t, ""), "package a\n\nfunc Foo() {}\n")
+	decl := testDecl(t, file, provider.KindFunc)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existed := NewResponseCache(tt.dir).exists()
+			chain, err := newProviderChain(&tt.cfg, nil, Options{Jobs: 1, Cache: NewResponseCache(tt.dir), Offline: true})
+			if err != nil {
+				t.Fatalf("newProviderChain() error = %v", err)
+			}
+
+			var names []string
+			for _, p := range chain.providers {
+				names = append(names, p.Name())
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Fatalf("providers = %q, want %q", names, tt.wantNames)
+			}
+			if _, err := os.Stat(tt.dir); !existed && err == nil {
+				t.Error("cache directory created offline")
+			}
+
+			if tt.cached {
+				p := chain.providers[0].(*cachedProvider)
+				if err := p.cache.put(p.key(decl), cacheEntry{Comment: provider.Comment{Summary: "Foo is cached."}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, producers, err := chain.comment(context.Background(), []provider.Decl{decl})
+			if err != nil {
+				t.Fatalf("comment() error = %v", err)
+			}
+			if producers[0] != tt.want {
+				t.Errorf("producer = %q, want %q", producers[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenResponseCache(t *testing.T) {
+	blocked := filepath.Join(t.TempDir(), "file")
+	writeTestFile(t, blocked, "")
+
+	if _, err := OpenResponseCache(filepath.Join(blocked, "cache")); err == nil {
+		t.Error("OpenResponseCache() error = nil, want an error")
+	}
+
+	dir := filepath.Join(t.TempDir(), "cache")
+	cache, err := OpenResponseCache(dir)
+	if err != nil {
+		t.Fatalf("OpenResponseCache() error = %v", err)
+	}
+	if !cache.open() || cache.Dir() != dir {
+		t.Errorf("open() = false or Dir() = %q, want an open cache in %q", cache.Dir(), dir)
+	}
+}
+
+func TestCachedProvider(t *testing.T) {
+	var sent []string
+	p := newCachedProvider(funcProvider{name: "counting", fn: func(decls []provider.Decl) ([]provider.Comment, error) {
+		comments := make([]provider.Comment, len(decls))
+		for i, decl := range decls {
+			sent = append(sent, decl.Name)
+			if decl.Name != "Skip" {
+				comments[i] = provider.Comment{Summary: decl.Name + " " + decl.Body + "."}
+			}
+		}
+		return comments, nil
+	}}, NewResponseCache(t.TempDir()), PromptConfig{})
+	if !p.cache.open() {
+		t.Fatal("cache not opened")
+	}
+
+	tests := []struct {
+		name     string
+		decls    []provider.Decl
+		want     []string
+		wantSent []string
+	}{
+		{
+			name:     "empty cache",
+			decls:    []provider.Decl{{Kind: provider.KindFunc, Name: "A", Body: "one"}, {Kind: provider.KindFunc, Name: "Skip"}},
+			want:     []string{"A one.", ""},
+			wantSent: []string{"A", "Skip"},
+		},
+		{
+			name:     "cached comment",
+			decls:    []provider.Decl{{Kind: provider.KindFunc, Name: "A", Body: "one"}, {Kind: provider.KindFunc, Name: "Skip"}},
+			want:     []string{"A one.", ""},
+			wantSent: []string{"Skip"},
+		},
+		{
+			name:     "changed declaration",
+			decls:    []provider.Decl{{Kind: provider.KindFunc, Name: "A", Body: "two"}, {Kind: provider.KindFunc, Name: "A", File: "b.go", Body: "one"}},
+			want:     []string{"A two.", "A one."},
+			wantSent: []string{"A"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent = nil
+			comments, err := p.Comment(context.Background(), tt.decls)
+			if err != nil {
+				t.Fatalf("Comment() error = %v", err)
+			}
+
+			got := make([]string, len(comments))
+			for i, comment := range comments {
+				got[i] = comment.Text()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Comment() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(sent, tt.wantSent) {
+				t.Errorf("sent %q, want %q", sent, tt.wantSent)
+			}
+		})
+	}
+}
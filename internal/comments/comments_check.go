@@ -0,0 +1,257 @@
+package comments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The rules of the findings of the check mode.
+const (
+	// RuleMissing reports an exported declaration without doc comment.
+	RuleMissing = "missing-doc"
+	// RuleStale reports a generated comment whose declaration changed
+	// since the comment was written.
+	RuleStale = "stale-doc"
+)
+
+// ruleDescriptions are the descriptions of the rules, for the SARIF output.
+var ruleDescriptions = map[string]string{
+	RuleMissing: "Exported declaration without doc comment",
+	RuleStale:   "Generated doc comment out of date with its declaration",
+}
+
+// The output formats of the findings.
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatSARIF = "sarif"
+)
+
+// Finding is a missing or stale doc comment found in the check mode.
+type Finding struct {
+	Position token.Position
+	// Kind is the kind of the declaration, like "func" or "method".
+	Kind string
+	// Name is the name of the declaration, like "Open" or "File.Close"
+	// for a method.
+	Name string
+	// Rule is RuleMissing or RuleStale.
+	Rule string
+}
+
+// Message returns the description of the finding.
+func (f Finding) Message() string {
+	if f.Rule == RuleStale {
+		return fmt.Sprintf("stale comment on %s %s", f.Kind, f.Name)
+	}
+	return fmt.Sprintf("missing comment on exported %s %s", f.Kind, f.Name)
+}
+
+// String returns the "file:line:col: message" representation of the finding.
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.Position, f.Message())
+}
+
+// Check returns the exported declarations of the given Go source file which
+// have no doc comment, and its generated comments whose declaration
+// fingerprint does not match anymore. The source is not modified and no
+// comment is generated.
+func Check(fileName string, src []byte, cache *CommentConfigCache) ([]Finding, error) {
+	file, err := newFile(fileName, src, cache, Options{})
+	if err != nil || file == nil {
+		return nil, err
+	}
+
+	file.check = true
+	if _, err := file.autoComment(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return file.findings, nil
+}
+
+// addFinding records a finding on the declaration at pos.
+func (file *file) addFinding(rule string, pos token.Pos, kind, name string) {
+	file.findings = append(file.findings, Finding{
+		Position: file.fSet.Position(pos),
+		Kind:     kind,
+		Name:     name,
+		Rule:     rule,
+	})
+}
+
+// isExportedName tells whether name is exported, both the type and the
+// method being exported for a method name like "File.Close".
+func isExportedName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if !token.IsExported(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteFindings writes the findings in the given format: "text", one
+// finding per line followed by the number of findings by rule, "json" or
+// "sarif", the SARIF 2.1.0 format of the code scanning tools.
+func WriteFindings(w io.Writer, format string, findings []Finding) error {
+	switch format {
+	case FormatText, "":
+		return writeFindingsText(w, findings)
+	case FormatJSON:
+		return writeFindingsJSON(w, findings)
+	case FormatSARIF:
+		return writeFindingsSARIF(w, findings)
+	default:
+		return fmt.Errorf("unknown format %q, expecting %s, %s or %s", format, FormatText, FormatJSON, FormatSARIF)
+	}
+}
+
+func writeFindingsText(w io.Writer, findings []Finding) error {
+	counts := make(map[string]int)
+	for _, finding := range findings {
+		if _, err := fmt.Fprintln(w, finding); err != nil {
+			return err
+		}
+		counts[finding.Rule]++
+	}
+
+	rules := make([]string, 0, len(counts))
+	for rule := range counts {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+
+	summary := fmt.Sprintf("%d %s", len(findings), pluralize("finding", len(findings)))
+	for i, rule := range rules {
+		rules[i] = fmt.Sprintf("%d %s", counts[rule], rule)
+	}
+	if len(rules) > 0 {
+		summary += ": " + strings.Join(rules, ", ")
+	}
+
+	_, err := fmt.Fprintln(w, summary)
+	return err
+}
+
+// jsonFinding is a finding in the JSON format.
+type jsonFinding struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func writeFindingsJSON(w io.Writer, findings []Finding) error {
+	out := make([]jsonFinding, len(findings))
+	for i, f := range findings {
+		out[i] = jsonFinding{
+			File:    filepath.ToSlash(f.Position.Filename),
+			Line:    f.Position.Line,
+			Column:  f.Position.Column,
+			Kind:    f.Kind,
+			Name:    f.Name,
+			Rule:    f.Rule,
+			Message: f.Message(),
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// The SARIF 2.1.0 log, reduced to the properties written by gocomments.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           sarifRegion           `json:"region"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn"`
+	}
+)
+
+func writeFindingsSARIF(w io.Writer, findings []Finding) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "gocomments",
+			InformationURI: "https://github.com/ariden83/gocomments",
+		}},
+		Results: []sarifResult{},
+	}
+	for _, rule := range []string{RuleMissing, RuleStale} {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               rule,
+			ShortDescription: sarifMessage{Text: ruleDescriptions[rule]},
+		})
+	}
+
+	for _, f := range findings {
+		run.Results = append(run.Results, sarifResult{
+			RuleID:  f.Rule,
+			Level:   "warning",
+			Message: sarifMessage{Text: f.Message()},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(f.Position.Filename)},
+					Region:           sarifRegion{StartLine: f.Position.Line, StartColumn: f.Position.Column},
+				},
+			}},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
@@ -0,0 +1,272 @@
+package comments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "declarations",
+			src: `package a
+
+func Foo() {}
+
+func bar() {}
+
+// Baz is documented.
+func Baz() {}
+
+const Max = 1
+`,
+			want: []string{
+				"a.go:3:1: missing comment on exported func Foo",
+				"a.go:10:1: missing comment on exported const Max",
+			},
+		},
+		{
+			name: "blocks",
+			src: `package a
+
+// The sizes.
+const (
+	MinSize = 1
+	MaxSize = 10
+)
+
+const (
+	low = iota
+	High
+)
+
+// The defaults.
+var (
+	Name = "a"
+	Size = 1
+)
+
+var (
+	Debug = false
+)
+`,
+			want: []string{
+				"a.go:9:1: missing comment on exported const High",
+				"a.go:21:2: missing comment on exported var Debug",
+			},
+		},
+		{
+			name: "struct fields",
+			src: `package a
+
+// Config is documented.
+type Config struct {
+	// Name is documented.
+	Name string
+	Port int // Port is documented.
+	Host string
+	debug bool
+	Server struct {
+		Addr string
+	}
+	*Logger
+}
+`,
+			want: []string{
+				"a.go:8:2: missing comment on exported field Config.Host",
+				"a.go:10:2: missing comment on exported field Config.Server",
+				"a.go:11:3: missing comment on exported field Config.Server.Addr",
+			},
+		},
+		{
+			name: "unexported struct",
+			src: `package a
+
+type config struct {
+	Name string
+}
+`,
+		},
+		{
+			name: "interface methods",
+			src: `package a
+
+// Store is documented.
+type Store interface {
+	// Get is documented.
+	Get(key string) string
+	Put(key, value string)
+	Close() error // Close is documented.
+	io.Reader
+	flush()
+}
+`,
+			want: []string{
+				"a.go:7:2: missing comment on exported interface-method Store.Put",
+			},
+		},
+		{
+			name: "stale field",
+			src: `package a
+
+// Config is documented.
+type Config struct {
+	// Name is generated.
+	//
+	// Author: Bot #00000000.
+	Name string
+}
+`,
+			want: []string{
+				"a.go:8:2: stale comment on field Config.Name",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, "signature: \"Bot\"\n")
+			path := filepath.Join(dir, "a.go")
+			writeTestFile(t, path, tt.src)
+
+			findings, err := Check(path, []byte(tt.src), NewConfigCache("", nil))
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+
+			var got []string
+			for _, finding := range findings {
+				finding.Position.Filename = filepath.Base(finding.Position.Filename)
+				got = append(got, finding.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestFields(t *testing.T) {
+	const src = `package a
+
+// Config is documented.
+type Config struct {
+	Host string
+}
+
+// Store is documented.
+type Store interface {
+	Close() error
+}
+`
+
+	dir := testModule(t, "")
+	path := filepath.Join(dir, "a.go")
+	writeTestFile(t, path, src)
+
+	suggestions, err := Suggest(context.Background(), path, []byte(src), NewConfigCache("", nil), Options{}, nil)
+	if err != nil {
+		t.Fatalf("Suggest() error = %v", err)
+	}
+
+	want := []string{"Config.Host", "Store.Close"}
+	if len(suggestions) != len(want) {
+		t.Fatalf("Suggest() = %+v, want suggestions on %q", suggestions, want)
+	}
+	for i, suggestion := range suggestions {
+		if suggestion.Name != want[i] {
+			t.Errorf("Suggest()[%d] on %s, want %s", i, suggestion.Name, want[i])
+		}
+		if suggestion.Start != suggestion.End || !strings.HasPrefix(strings.TrimSpace(suggestion.Text), "// ") {
+			t.Errorf("Suggest()[%d] = %q at %d-%d, want a comment inserted", i, suggestion.Text, suggestion.Start, suggestion.End)
+		}
+	}
+}
+
+func TestWriteFindings(t *testing.T) {
+	findings := []Finding{
+		{Position: token.Position{Filename: "a.go", Line: 3, Column: 1}, Kind: "func", Name: "Foo", Rule: RuleMissing},
+		{Position: token.Position{Filename: "a.go", Line: 8, Column: 2}, Kind: "field", Name: "Config.Name", Rule: RuleStale},
+		{Position: token.Position{Filename: "b.go", Line: 1, Column: 1}, Kind: "type", Name: "Bar", Rule: RuleMissing},
+	}
+
+	tests := []struct {
+		format  string
+		check   func(t *testing.T, out []byte)
+		wantErr bool
+	}{
+		{
+			format: FormatText,
+			check: func(t *testing.T, out []byte) {
+				want := "a.go:3:1: missing comment on exported func Foo\n" +
+					"a.go:8:2: stale comment on field Config.Name\n" +
+					"b.go:1:1: missing comment on exported type Bar\n" +
+					"3 findings: 2 missing-doc, 1 stale-doc\n"
+				if string(out) != want {
+					t.Errorf("output = %q, want %q", out, want)
+				}
+			},
+		},
+		{
+			format: FormatJSON,
+			check: func(t *testing.T, out []byte) {
+				var got []jsonFinding
+				if err := json.Unmarshal(out, &got); err != nil {
+					t.Fatalf("invalid JSON %s: %v", out, err)
+				}
+				want := jsonFinding{File: "a.go", Line: 8, Column: 2, Kind: "field", Name: "Config.Name", Rule: RuleStale, Message: "stale comment on field Config.Name"}
+				if len(got) != 3 || got[1] != want {
+					t.Errorf("output = %+v, want %+v second", got, want)
+				}
+			},
+		},
+		{
+			format: FormatSARIF,
+			check: func(t *testing.T, out []byte) {
+				var got sarifLog
+				if err := json.Unmarshal(out, &got); err != nil {
+					t.Fatalf("invalid SARIF %s: %v", out, err)
+				}
+				if got.Version != "2.1.0" || len(got.Runs) != 1 {
+					t.Fatalf("output = %+v, want one SARIF 2.1.0 run", got)
+				}
+				run := got.Runs[0]
+				if len(run.Tool.Driver.Rules) != 2 || len(run.Results) != 3 {
+					t.Fatalf("run = %+v, want 2 rules and 3 results", run)
+				}
+				result := run.Results[2]
+				if result.RuleID != RuleMissing || result.Locations[0].PhysicalLocation.ArtifactLocation.URI != "b.go" ||
+					result.Locations[0].PhysicalLocation.Region != (sarifRegion{StartLine: 1, StartColumn: 1}) {
+					t.Errorf("result = %+v, want the missing type Bar in b.go", result)
+				}
+			},
+		},
+		{
+			format:  "xml",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteFindings(&buf, tt.format, findings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteFindings() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, buf.Bytes())
+			}
+		})
+	}
+}
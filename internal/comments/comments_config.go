@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sync"
 
 	yaml "gopkg.in/yaml.v3"
 )
@@ -25,12 +26,39 @@ type CommentConfig struct {
 	// them with future updates of the script.
 	// If empty, the automatically added prefix is "auto".
 	Signature *string `yaml:"signature"`
+	// Interfaces are the interfaces mentioned in the comments of the types
+	// implementing them and of their methods, in the type-checked mode.
+	// They are written like "io.Reader" or "example.com/mod/pkg.Iface".
+	// The interfaces of the module are always looked for, and a list of
+	// common interfaces of the standard library is used when it is empty.
+	Interfaces []string `yaml:"interfaces"`
 	// Allows you to know if you update the tagged comments each time the script is executed.
-	UpdateComments bool            `yaml:"update-comments"`
+	// Only the comments ending with the signature are regenerated, the other
+	// ones are considered as written by a human and are never modified.
+	UpdateComments *bool `yaml:"update-comments"`
+	// Providers are the names of the providers tried in order for each
+	// declaration: "localai", "ollama", "openai", "anthropic", "default",
+	// the name of a plugin or the name of a provider registered with
+	// provider.Register. The default provider is always tried last. When
+	// empty, the active built-in AI providers and plugins are used.
+	Providers      []string        `yaml:"providers"`
 	ActiveExamples bool            `yaml:"active-examples"`
 	LocalAI        LocalAIConfig   `yaml:"localai"`
+	Ollama         OllamaConfig    `yaml:"ollama"`
 	OpenAI         OpenAIConfig    `yaml:"openai"`
 	Anthropic      AnthropicConfig `yaml:"anthropic"`
+	// Plugins are the providers running external commands. The plugins of
+	// a subdirectory replace the ones with the same name.
+	Plugins []PluginConfig `yaml:"plugins"`
+	// Prompts are the templates of the prompts of the AI providers. The
+	// templates of a subdirectory replace the ones of the parent directory.
+	Prompts PromptConfig `yaml:"prompts"`
+	// Templates is the directory of the *.tmpl files overriding the comment
+	// templates of the default provider, relative to the .gocomments file.
+	Templates string `yaml:"templates"`
+	// MinCoverage is the minimum percentage of documented exported
+	// declarations of the packages, under which the coverage command fails.
+	MinCoverage *float64 `yaml:"min-coverage"`
 }
 
 // Merge merges the given CommentConfig with this configure and return
@@ -38,12 +66,35 @@ type CommentConfig struct {
 // - Local attribute value is overriden.
 // - Prefixes attribute values are appended.
 func (cfg *CommentConfig) Merge(newCfg *CommentConfig) *CommentConfig {
+	// Work on a copy: the parent configuration is shared by the files of
+	// the other directories, possibly processed concurrently.
+	merged := *cfg
+	cfg = &merged
+
 	if newCfg.Local != "" {
 		cfg.Local = newCfg.Local
 	}
 	if newCfg.Signature != nil {
 		cfg.Signature = newCfg.Signature
 	}
+	if newCfg.UpdateComments != nil {
+		cfg.UpdateComments = newCfg.UpdateComments
+	}
+	if len(newCfg.Providers) > 0 {
+		cfg.Providers = newCfg.Providers
+	}
+	if len(newCfg.Interfaces) > 0 {
+		cfg.Interfaces = newCfg.Interfaces
+	}
+	if newCfg.ActiveExamples {
+		cfg.ActiveExamples = true
+	}
+	if newCfg.Templates != "" {
+		cfg.Templates = newCfg.Templates
+	}
+	if newCfg.MinCoverage != nil {
+		cfg.MinCoverage = newCfg.MinCoverage
+	}
 
 	{
 		cfg.LocalAI.URL = "http://:5000"
@@ -57,34 +108,22 @@ func (cfg *CommentConfig) Merge(newCfg *CommentConfig) *CommentConfig {
 		if newCfg.LocalAI.URL != "" {
 			cfg.LocalAI.URL = newCfg.LocalAI.URL
 		}
+		cfg.LocalAI.HTTP = cfg.LocalAI.HTTP.Merge(newCfg.LocalAI.HTTP)
 	}
 
-	{
-		if newCfg.OpenAI.Active != nil {
-			cfg.OpenAI.Active = newCfg.OpenAI.Active
-		}
-		if newCfg.OpenAI.APIKey != nil {
-			cfg.OpenAI.APIKey = newCfg.OpenAI.APIKey
-		}
-		if newCfg.OpenAI.URL != "" {
-			cfg.OpenAI.URL = newCfg.OpenAI.URL
-		}
-	}
-
-	{
-		if newCfg.Anthropic.Active != nil {
-			cfg.Anthropic.Active = newCfg.Anthropic.Active
-		}
-		if newCfg.Anthropic.URL != "" {
-			cfg.Anthropic.URL = newCfg.Anthropic.URL
-		}
-	}
+	cfg.Ollama = cfg.Ollama.Merge(newCfg.Ollama)
+	cfg.OpenAI = cfg.OpenAI.Merge(newCfg.OpenAI)
+	cfg.Anthropic = cfg.Anthropic.Merge(newCfg.Anthropic)
+	cfg.Plugins = mergePlugins(cfg.Plugins, newCfg.Plugins)
+	cfg.Prompts = cfg.Prompts.Merge(newCfg.Prompts)
 
 	return cfg
 }
 
 // CommentConfigCache is a cache to contains the configuration for all processed files.
+// It is safe for concurrent use.
 type CommentConfigCache struct {
+	mu         sync.Mutex
 	rootConfig CommentConfig
 	configs    map[string]*CommentConfig
 }
@@ -106,6 +145,9 @@ func (cache *CommentConfigCache) Get(filename string) (*CommentConfig, error) {
 	absFilepath, _ := filepath.Abs(filename)
 	dirPath := filepath.Dir(absFilepath)
 
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
 	cfg, err := cache.get(dirPath)
 	if err != nil {
 		return nil, err
@@ -181,6 +223,13 @@ func readConfigFile(filename string) (*CommentConfig, error) {
 		return nil, err
 	}
 
+	for i := range cfg.Plugins {
+		cfg.Plugins[i].dir = filepath.Dir(filename)
+	}
+	if cfg.Templates != "" && !filepath.IsAbs(cfg.Templates) {
+		cfg.Templates = filepath.Join(filepath.Dir(filename), cfg.Templates)
+	}
+
 	return &cfg, nil
 }
 
@@ -0,0 +1,58 @@
+package comments
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConfigCacheConcurrent(t *testing.T) {
+	dir := testModule(t, "signature: \"Root\"\n")
+	writeTestFile(t, filepath.Join(dir, "sub", ".gocomments"), "signature: \"Sub\"\n")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: filepath.Join(dir, "a.go"), want: "Root"},
+		{path: filepath.Join(dir, "other", "b.go"), want: "Root"},
+		{path: filepath.Join(dir, "sub", "c.go"), want: "Sub"},
+		{path: filepath.Join(dir, "sub", "deep", "d.go"), want: "Sub"},
+	}
+
+	cache := NewConfigCache("", nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		for _, tt := range tests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				cfg, err := cache.Get(tt.path)
+				if err != nil {
+					t.Errorf("Get(%s) error = %v", tt.path, err)
+					return
+				}
+				if cfg.Signature == nil || *cfg.Signature != tt.want {
+					t.Errorf("Get(%s) signature = %v, want %q", tt.path, cfg.Signature, tt.want)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func TestConfigMergeKeepsTheParent(t *testing.T) {
+	root, sub := "Root", "Sub"
+	parent := &CommentConfig{Signature: &root, Prefixes: []string{"a"}}
+
+	merged := parent.Merge(&CommentConfig{Signature: &sub, Prefixes: []string{"b"}})
+
+	if *merged.Signature != "Sub" {
+		t.Errorf("merged signature = %q, want %q", *merged.Signature, "Sub")
+	}
+	if *parent.Signature != "Root" || len(parent.Prefixes) != 1 {
+		t.Errorf("parent modified by Merge: signature %q, prefixes %q", *parent.Signature, parent.Prefixes)
+	}
+}
@@ -0,0 +1,394 @@
+package comments
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// The output formats of the coverage report, besides FormatJSON.
+const (
+	FormatTable = "table"
+	FormatHTML  = "html"
+)
+
+// coverageKinds are the kinds of the declarations counted by the coverage
+// report, in the order of its columns.
+var coverageKinds = []string{"func", "method", "type", "field", "var", "const"}
+
+// CoverageCounts are the numbers of exported declarations, and of the ones
+// documented by a human or by a comment signed by the tool.
+type CoverageCounts struct {
+	Total int `json:"total"`
+	Human int `json:"human"`
+	Bot   int `json:"bot"`
+}
+
+// Documented returns the number of documented declarations.
+func (c CoverageCounts) Documented() int {
+	return c.Human + c.Bot
+}
+
+// Percent returns the percentage of documented declarations, 100 when there
+// is no declaration.
+func (c CoverageCounts) Percent() float64 {
+	if c.Total == 0 {
+		return 100
+	}
+	return 100 * float64(c.Documented()) / float64(c.Total)
+}
+
+// add adds the counts of other to c.
+func (c *CoverageCounts) add(other CoverageCounts) {
+	c.Total += other.Total
+	c.Human += other.Human
+	c.Bot += other.Bot
+}
+
+// PackageCoverage is the documentation coverage of a package.
+type PackageCoverage struct {
+	// Dir is the directory of the package and Name its name.
+	Dir  string
+	Name string
+	// Kinds are the counts by kind of declaration, like "func" or "field".
+	Kinds map[string]CoverageCounts
+	Total CoverageCounts
+	// MinCoverage is the min-coverage of the configuration of the package,
+	// or nil if there is none.
+	MinCoverage *float64
+}
+
+// BelowMin tells whether the coverage of the package is below its
+// min-coverage.
+func (p *PackageCoverage) BelowMin() bool {
+	return p.MinCoverage != nil && p.Total.Percent() < *p.MinCoverage
+}
+
+// CoverageReport is the documentation coverage of the packages of a run.
+type CoverageReport struct {
+	packages map[string]*PackageCoverage
+}
+
+// NewCoverageReport instantiates an empty coverage report.
+func NewCoverageReport() *CoverageReport {
+	return &CoverageReport{packages: make(map[string]*PackageCoverage)}
+}
+
+// AddFile counts the exported declarations of the given Go source file and
+// their doc comments. The test files are skipped.
+func (r *CoverageReport) AddFile(fileName string, src []byte, cache *CommentConfigCache) error {
+	file, err := newFile(fileName, src, cache, Options{})
+	if err != nil || file == nil {
+		return err
+	}
+
+	dir := filepath.Dir(fileName)
+	key := dir + " " + file.f.Name.Name
+	pkg, ok := r.packages[key]
+	if !ok {
+		pkg = &PackageCoverage{
+			Dir:         dir,
+			Name:        file.f.Name.Name,
+			Kinds:       make(map[string]CoverageCounts),
+			MinCoverage: file.cfg.MinCoverage,
+		}
+		r.packages[key] = pkg
+	}
+
+	file.coverage(pkg)
+	return nil
+}
+
+// Packages returns the coverage of the packages sorted by directory.
+func (r *CoverageReport) Packages() []*PackageCoverage {
+	packages := make([]*PackageCoverage, 0, len(r.packages))
+	for _, pkg := range r.packages {
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Dir != packages[j].Dir {
+			return packages[i].Dir < packages[j].Dir
+		}
+		return packages[i].Name < packages[j].Name
+	})
+	return packages
+}
+
+// Total returns the counts of all the packages.
+func (r *CoverageReport) Total() CoverageCounts {
+	var total CoverageCounts
+	for _, pkg := range r.packages {
+		total.add(pkg.Total)
+	}
+	return total
+}
+
+// coverage counts the exported declarations of the file and their doc
+// comments in pkg.
+func (file *file) coverage(pkg *PackageCoverage) {
+	count := func(kind, name string, doc *ast.CommentGroup) {
+		if !isExportedName(name) {
+			return
+		}
+
+		c := CoverageCounts{Total: 1}
+		switch {
+		case doc.Text() == "":
+		case file.isGenerated(doc):
+			c.Bot = 1
+		default:
+			c.Human = 1
+		}
+
+		counts := pkg.Kinds[kind]
+		counts.add(c)
+		pkg.Kinds[kind] = counts
+		pkg.Total.add(c)
+	}
+
+	for _, decl := range file.f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				count("method", embeddedName(decl.Recv.List[0].Type)+"."+decl.Name.Name, decl.Doc)
+			} else {
+				count("func", decl.Name.Name, decl.Doc)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					doc, _ := specDoc(decl, spec, spec.Doc)
+					count("type", spec.Name.Name, groupDoc(decl, doc))
+					if st, ok := spec.Type.(*ast.StructType); ok && spec.Name.IsExported() {
+						file.fieldsCoverage(st.Fields, count)
+					}
+				case *ast.ValueSpec:
+					kind := "var"
+					if decl.Tok == token.CONST {
+						kind = "const"
+					}
+					doc, _ := specDoc(decl, spec, spec.Doc)
+					for _, name := range spec.Names {
+						count(kind, name.Name, groupDoc(decl, doc))
+					}
+				}
+			}
+		}
+	}
+}
+
+// fieldsCoverage counts the exported fields of a struct, including the
+// ones of its anonymous nested structs. A field having a trailing line
+// comment is documented, and the embedded fields, documented by their type,
+// are not counted.
+func (file *file) fieldsCoverage(fields *ast.FieldList, count func(kind, name string, doc *ast.CommentGroup)) {
+	if fields == nil {
+		return
+	}
+
+	for _, field := range fields.List {
+		doc := field.Doc
+		if doc.Text() == "" {
+			doc = field.Comment
+		}
+
+		for _, name := range field.Names {
+			count("field", name.Name, doc)
+		}
+
+		if nested := nestedStruct(field.Type); nested != nil && len(field.Names) > 0 && field.Names[0].IsExported() {
+			file.fieldsCoverage(nested.Fields, count)
+		}
+	}
+}
+
+// groupDoc returns the doc of a grouped spec, or the doc of its group when
+// it has none, which documents all the specs of the group like with go doc.
+func groupDoc(genDecl *ast.GenDecl, doc *ast.CommentGroup) *ast.CommentGroup {
+	if doc.Text() == "" && genDecl.Lparen.IsValid() {
+		return genDecl.Doc
+	}
+	return doc
+}
+
+// isGenerated tells whether doc was generated by the tool, ending with its
+// signature.
+func (file *file) isGenerated(doc *ast.CommentGroup) bool {
+	i, _ := file.signature(doc)
+	return i >= 0
+}
+
+// Write writes the report in the given format: "table", a table of the
+// packages, "json" or "html", a standalone HTML page.
+func (r *CoverageReport) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatTable, "":
+		return r.writeTable(w)
+	case FormatJSON:
+		return r.writeJSON(w)
+	case FormatHTML:
+		return r.writeHTML(w)
+	default:
+		return fmt.Errorf("unknown format %q, expecting %s, %s or %s", format, FormatTable, FormatJSON, FormatHTML)
+	}
+}
+
+// formatCounts returns the counts of a kind as "documented/total", or "-"
+// when there is no declaration of this kind.
+func formatCounts(c CoverageCounts) string {
+	if c.Total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d", c.Documented(), c.Total)
+}
+
+// formatPercent returns the coverage of a package, marked when it is below
+// its min-coverage.
+func formatPercent(pkg *PackageCoverage) string {
+	txt := fmt.Sprintf("%.1f%%", pkg.Total.Percent())
+	if pkg.BelowMin() {
+		txt += fmt.Sprintf(" < %.1f%%", *pkg.MinCoverage)
+	}
+	return txt
+}
+
+func (r *CoverageReport) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	header := append([]string{"PACKAGE"}, coverageKinds...)
+	header = append(header, "HUMAN", "BOT", "COVERAGE")
+	_, _ = fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+
+	for _, pkg := range r.Packages() {
+		row := []string{pkg.Dir + " (" + pkg.Name + ")"}
+		for _, kind := range coverageKinds {
+			row = append(row, formatCounts(pkg.Kinds[kind]))
+		}
+		row = append(row, fmt.Sprint(pkg.Total.Human), fmt.Sprint(pkg.Total.Bot), formatPercent(pkg))
+		_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	total := r.Total()
+	_, _ = fmt.Fprintf(tw, "total\t%s\t%d\t%d\t%.1f%%\n", strings.Repeat("\t", len(coverageKinds)-1), total.Human, total.Bot, total.Percent())
+
+	return tw.Flush()
+}
+
+// jsonCoverage is the coverage of a package in the JSON format.
+type jsonCoverage struct {
+	Dir         string                    `json:"dir"`
+	Name        string                    `json:"name"`
+	Kinds       map[string]CoverageCounts `json:"kinds"`
+	Total       CoverageCounts            `json:"total"`
+	Coverage    float64                   `json:"coverage"`
+	MinCoverage *float64                  `json:"min_coverage,omitempty"`
+	BelowMin    bool                      `json:"below_min,omitempty"`
+}
+
+func (r *CoverageReport) writeJSON(w io.Writer) error {
+	var out struct {
+		Packages []jsonCoverage `json:"packages"`
+		Total    CoverageCounts `json:"total"`
+		Coverage float64        `json:"coverage"`
+	}
+
+	out.Packages = []jsonCoverage{}
+	for _, pkg := range r.Packages() {
+		out.Packages = append(out.Packages, jsonCoverage{
+			Dir:         filepath.ToSlash(pkg.Dir),
+			Name:        pkg.Name,
+			Kinds:       pkg.Kinds,
+			Total:       pkg.Total,
+			Coverage:    pkg.Total.Percent(),
+			MinCoverage: pkg.MinCoverage,
+			BelowMin:    pkg.BelowMin(),
+		})
+	}
+	out.Total = r.Total()
+	out.Coverage = out.Total.Percent()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// coverageRow is a package or the total in the HTML report.
+type coverageRow struct {
+	Name     string
+	Counts   []string
+	Total    CoverageCounts
+	Percent  string
+	BelowMin bool
+}
+
+// Width returns the width of the bar of the row, in percent.
+func (r coverageRow) Width() string {
+	return fmt.Sprintf("%.0f%%", r.Total.Percent())
+}
+
+func (r *CoverageReport) writeHTML(w io.Writer) error {
+	var rows []coverageRow
+	for _, pkg := range r.Packages() {
+		row := coverageRow{
+			Name:     filepath.ToSlash(pkg.Dir) + " (" + pkg.Name + ")",
+			Total:    pkg.Total,
+			Percent:  formatPercent(pkg),
+			BelowMin: pkg.BelowMin(),
+		}
+		for _, kind := range coverageKinds {
+			row.Counts = append(row.Counts, formatCounts(pkg.Kinds[kind]))
+		}
+		rows = append(rows, row)
+	}
+
+	total := r.Total()
+	return coverageHTML.Execute(w, struct {
+		Kinds   []string
+		Rows    []coverageRow
+		Total   CoverageCounts
+		Percent string
+	}{
+		Kinds:   coverageKinds,
+		Rows:    rows,
+		Total:   total,
+		Percent: fmt.Sprintf("%.1f%%", total.Percent()),
+	})
+}
+
+// coverageHTML is the template of the HTML report, a standalone page.
+var coverageHTML = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Documentation coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.3em 0.8em; border-bottom: 1px solid #ddd; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.bar { display: inline-block; width: 100px; height: 0.8em; background: #eee; vertical-align: middle; margin-right: 0.5em; }
+.bar span { display: block; height: 100%; background: #4c9a2a; }
+.below { color: #c0392b; }
+.below .bar span { background: #c0392b; }
+</style>
+</head>
+<body>
+<h1>Documentation coverage</h1>
+<p>{{.Total.Documented}} of the {{.Total.Total}} exported declarations are documented ({{.Percent}}), {{.Total.Human}} by a human and {{.Total.Bot}} by gocomments.</p>
+<table>
+<tr><th>Package</th>{{range .Kinds}}<th>{{.}}</th>{{end}}<th>Human</th><th>Bot</th><th>Coverage</th></tr>
+{{- range .Rows}}
+<tr{{if .BelowMin}} class="below"{{end}}><td>{{.Name}}</td>{{range .Counts}}<td>{{.}}</td>{{end}}<td>{{.Total.Human}}</td><td>{{.Total.Bot}}</td><td><span class="bar"><span style="width: {{.Width}}"></span></span>{{.Percent}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
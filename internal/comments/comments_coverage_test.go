@@ -0,0 +1,187 @@
+package comments
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// coverageFixture mixes declarations without comment, documented by a human
+// and signed by the tool, and an embedded field which is not counted.
+const coverageFixture = `package a
+
+// Store is written by a human.
+type Store struct {
+	// Name is written by a human.
+	Name string
+	Size int // Size is a trailing comment.
+	Path string
+	// Mode is generated.
+	//
+	// Author: Bot #00000000.
+	Mode int
+	cache map[string]string
+	*Base
+	Options struct {
+		Debug bool // Debug is a trailing comment.
+		Level int
+	}
+}
+
+// Open is generated.
+//
+// Author: Bot #00000000.
+func Open() *Store { return nil }
+
+func Close() {}
+
+func helper() {}
+
+// Get is written by a human.
+func (s *Store) Get() string { return "" }
+
+func (s *Store) Put() {}
+
+// The limits, documented by the group.
+const (
+	MinSize = 1
+	MaxSize = 10
+)
+
+var (
+	// Default is written by a human.
+	Default = &Store{}
+	Empty   *Store
+	unused  *Store
+)
+
+type private struct {
+	Name string
+}
+`
+
+func TestCoverage(t *testing.T) {
+	dir := testModule(t, "signature: \"Bot\"\nmin-coverage: 80\n")
+	writeTestFile(t, filepath.Join(dir, "a.go"), coverageFixture)
+
+	report := NewCoverageReport()
+	if err := report.AddFile(filepath.Join(dir, "a.go"), []byte(coverageFixture), NewConfigCache("", nil)); err != nil {
+		t.Fatalf("AddFile() error = %v", err)
+	}
+
+	packages := report.Packages()
+	if len(packages) != 1 {
+		t.Fatalf("Packages() = %d packages, want 1", len(packages))
+	}
+	pkg := packages[0]
+
+	want := map[string]CoverageCounts{
+		"type":   {Total: 1, Human: 1},
+		"field":  {Total: 7, Human: 3, Bot: 1},
+		"func":   {Total: 2, Bot: 1},
+		"method": {Total: 2, Human: 1},
+		"const":  {Total: 2, Human: 2},
+		"var":    {Total: 2, Human: 1},
+	}
+	if !reflect.DeepEqual(pkg.Kinds, want) {
+		t.Errorf("Kinds = %+v, want %+v", pkg.Kinds, want)
+	}
+	if wantTotal := (CoverageCounts{Total: 16, Human: 8, Bot: 2}); pkg.Total != wantTotal || report.Total() != wantTotal {
+		t.Errorf("Total = %+v and report total %+v, want %+v", pkg.Total, report.Total(), wantTotal)
+	}
+	if !pkg.BelowMin() {
+		t.Errorf("BelowMin() = false with %.1f%% below 80%%", pkg.Total.Percent())
+	}
+}
+
+func TestCoverageWrite(t *testing.T) {
+	minCoverage := 80.0
+	report := NewCoverageReport()
+	report.packages["a a"] = &PackageCoverage{
+		Dir:         "a",
+		Name:        "a",
+		Kinds:       map[string]CoverageCounts{"func": {Total: 4, Human: 2, Bot: 1}, "field": {Total: 4, Human: 1}},
+		Total:       CoverageCounts{Total: 8, Human: 3, Bot: 1},
+		MinCoverage: &minCoverage,
+	}
+	report.packages["b b"] = &PackageCoverage{
+		Dir:   "b",
+		Name:  "b",
+		Kinds: map[string]CoverageCounts{"type": {Total: 2, Human: 2}},
+		Total: CoverageCounts{Total: 2, Human: 2},
+	}
+
+	tests := []struct {
+		format  string
+		check   func(t *testing.T, out string)
+		wantErr bool
+	}{
+		{
+			format: FormatTable,
+			check: func(t *testing.T, out string) {
+				want := []string{
+					"PACKAGE  FUNC  METHOD  TYPE  FIELD  VAR  CONST  HUMAN  BOT  COVERAGE",
+					"a (a)    3/4   -       -     1/4    -    -      3      1    50.0% < 80.0%",
+					"b (b)    -     -       2/2   -      -    -      2      0    100.0%",
+					"total                                           5      1    60.0%",
+				}
+				if got := strings.Split(strings.TrimRight(out, "\n"), "\n"); !reflect.DeepEqual(got, want) {
+					t.Errorf("output =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+				}
+			},
+		},
+		{
+			format: FormatJSON,
+			check: func(t *testing.T, out string) {
+				var got struct {
+					Packages []jsonCoverage `json:"packages"`
+					Total    CoverageCounts `json:"total"`
+					Coverage float64        `json:"coverage"`
+				}
+				if err := json.Unmarshal([]byte(out), &got); err != nil {
+					t.Fatalf("invalid JSON %s: %v", out, err)
+				}
+				if len(got.Packages) != 2 || !got.Packages[0].BelowMin || got.Packages[1].BelowMin ||
+					got.Packages[0].Coverage != 50 || got.Coverage != 60 || got.Total.Human != 5 {
+					t.Errorf("output = %+v, want a below 80%% and a total of 60%%", got)
+				}
+			},
+		},
+		{
+			format: FormatHTML,
+			check: func(t *testing.T, out string) {
+				for _, want := range []string{
+					"<!DOCTYPE html>",
+					"6 of the 10 exported declarations are documented (60.0%), 5 by a human and 1 by gocomments.",
+					`<tr class="below"><td>a (a)</td><td>3/4</td>`,
+					`<span style="width: 50%">`,
+					"<td>b (b)</td>",
+				} {
+					if !strings.Contains(out, want) {
+						t.Errorf("output does not contain %q:\n%s", want, out)
+					}
+				}
+			},
+		},
+		{
+			format:  "csv",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := report.Write(&buf, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Write() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, buf.String())
+			}
+		})
+	}
+}
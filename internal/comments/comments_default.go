@@ -1,243 +1,610 @@
 package comments
 
 import (
-	"fmt"
+	"context"
 	"go/ast"
+	"reflect"
+	"strconv"
 	"strings"
+	"text/template"
+
+	"github.com/ariden/gocomments/provider"
 )
 
 type defaultProcess struct {
 	activeExamples bool
+	// types resolves the types of the declarations in the type-checked mode.
+	types *typesInfo
+	// templates are the comment templates, the embedded ones overridden by
+	// the templates directory of the configuration.
+	templates *template.Template
+	// jobs is the number of declarations commented concurrently by the
+	// providers embedding the default one. The default provider itself
+	// comments them one at a time, as it does not wait for any network call.
+	jobs int
 }
 
 func (d *defaultProcess) isActive() bool {
 	return true
 }
 
-func (d *defaultProcess) commentFunc(fn *ast.FuncDecl) (string, error) {
+func (d *defaultProcess) checkConfig() error {
+	return nil
+}
 
-	var (
-		txt     string
-		inputs  []ast.Expr
-		outputs []ast.Expr
-	)
-	if isNewFunc(fn.Name.Name) {
-		return d.newFuncTxt(fn), nil
-	}
+// Name returns the name of the default provider.
+func (d *defaultProcess) Name() string {
+	return "default"
+}
+
+// Comment generates the comments of decls offline, from their syntax and
+// their resolved types.
+func (d *defaultProcess) Comment(ctx context.Context, decls []provider.Decl) ([]provider.Comment, error) {
+	return commentDecls(ctx, d, decls, 1)
+}
 
-	privateValue := ""
-	if !fn.Name.IsExported() {
-		privateValue = "private "
+// render executes the first comment template found in names with data.
+func (d *defaultProcess) render(data any, names ...string) (string, error) {
+	tmpl := d.templates
+	if tmpl == nil {
+		tmpl = defaultTemplates
 	}
+	return renderTemplate(tmpl, data, names...)
+}
 
-	explainFunc := convertCamelCaseTo(fn.Name.Name)
+// funcData is the data of the func.tmpl and method.tmpl templates.
+type funcData struct {
+	Name string
+	// Private is "private " for the unexported functions, so that
+	// {{withArticle (print .Private "function")}} gives "a private function".
+	Private string
+	Method  bool
+	// Receiver describes the type of a method, like "the Client struct".
+	Receiver string
+	// Action describes what the function does from its name, like
+	// "retrieves the user name", or is empty when its verb is not known.
+	Action string
+	// Constructor tells whether the function is a constructor, named like
+	// "NewClient", and Constructed is the type it returns, like "Client".
+	Constructor bool
+	Constructed string
+	Params      []provider.Field
+	TypeParams  []typeParamData
+	// Results are the types of the results other than the errors.
+	Results      []string
+	ReturnsError bool
+	// Errors are the sentences describing the errors returned, found in the
+	// body of the function.
+	Errors  []string
+	Panics  bool
+	Effects []string
+	// Example are the lines of an example call, when the examples are
+	// enabled and the types of the arguments are simple enough.
+	Example []string
+}
+
+func (d *defaultProcess) commentFunc(_ context.Context, decl provider.Decl) (string, error) {
+	fn := decl.Node.(*ast.FuncDecl)
+
+	data := funcData{
+		Name:        fn.Name.Name,
+		Private:     privateTxt(fn.Name.IsExported()),
+		Method:      fn.Recv != nil,
+		Receiver:    receiverTxt(decl),
+		Action:      describeAction(fn.Name.Name),
+		Constructor: isNewFunc(fn.Name.Name),
+		Params:      d.fields(fn.Type.Params),
+		TypeParams:  typeParams(fn.Type.TypeParams),
+		Effects:     decl.Effects,
+	}
 
-	if (fn.Type.Params == nil || len(fn.Type.Params.List) == 0) && (fn.Type.Results == nil || len(fn.Type.Results.List) == 0) {
-		if fn.Recv != nil {
-			funcType := ""
-			if fn.Recv != nil && len(fn.Recv.List) > 0 {
-				if t, ok := fn.Recv.List[0].Type.(*ast.Ident); ok {
-					funcType = t.String()
+	if fn.Type.Results != nil {
+		for _, res := range fn.Type.Results.List {
+			typeName := d.types.typeString(res.Type)
+			n := max(len(res.Names), 1)
+			for i := 0; i < n; i++ {
+				if typeName == "error" {
+					data.ReturnsError = true
+				} else {
+					data.Results = append(data.Results, typeName)
 				}
 			}
-			txt = fmt.Sprintf("// %s is a %smethod%s that belongs to the %s struct.\n// It does not take any arguments.\n", fn.Name.Name, privateValue, explainFunc, funcType)
-		} else {
-			txt = fmt.Sprintf("// %s is a %smethod%s.\n// It does not take any arguments.\n", fn.Name.Name, privateValue, explainFunc)
 		}
+	}
+	if data.Constructor && len(data.Results) > 0 {
+		data.Constructed = strings.TrimLeft(data.Results[0], "*&")
+	}
 
-	} else {
-		if fn.Recv != nil {
-			funcType := ""
-			if fn.Recv != nil && len(fn.Recv.List) > 0 {
-				if t, ok := fn.Recv.List[0].Type.(*ast.Ident); ok {
-					funcType = t.String()
-				}
-			}
-			txt = fmt.Sprintf("// %s is a %smethod%s that belongs to the %s struct", fn.Name.Name, privateValue, explainFunc, funcType)
-		} else {
-			txt = fmt.Sprintf("// %s is a %smethod%s", fn.Name.Name, privateValue, explainFunc)
+	// The error sentences were found by the analysis of the body in decl.
+	for _, sentence := range decl.Errors {
+		if sentence == panicSentence {
+			data.Panics = true
+		} else if data.ReturnsError {
+			data.Errors = append(data.Errors, sentence)
 		}
+	}
 
-		if fn.Type.Params != nil {
-			if len(fn.Type.Params.List) != 0 {
-				txt += " that take "
-			}
+	data.Example = d.exampleGenerator(fn)
+
+	names := []string{"func.tmpl"}
+	if data.Method {
+		names = []string{"method.tmpl", "func.tmpl"}
+	}
+	return d.render(data, names...)
+}
+
+// actionVerbs are the verbs starting the function names, with the verb
+// describing what the function does.
+var actionVerbs = map[string]string{
+	"add":        "adds",
+	"apply":      "applies",
+	"build":      "builds",
+	"check":      "checks",
+	"clear":      "clears",
+	"compute":    "computes",
+	"count":      "counts",
+	"create":     "creates",
+	"decode":     "decodes",
+	"delete":     "deletes",
+	"encode":     "encodes",
+	"fetch":      "fetches",
+	"find":       "finds",
+	"format":     "formats",
+	"get":        "retrieves",
+	"handle":     "handles",
+	"init":       "initializes",
+	"initialize": "initializes",
+	"list":       "lists",
+	"load":       "loads",
+	"parse":      "parses",
+	"process":    "processes",
+	"read":       "reads",
+	"register":   "registers",
+	"remove":     "removes",
+	"render":     "renders",
+	"reset":      "resets",
+	"run":        "runs",
+	"save":       "saves",
+	"send":       "sends",
+	"set":        "sets",
+	"start":      "starts",
+	"stop":       "stops",
+	"update":     "updates",
+	"validate":   "validates",
+	"write":      "writes",
+}
+
+// describeAction describes what a function does from its name, like
+// "retrieves the user name" for "GetUserName" or "reports whether it is
+// valid" for "IsValid". It returns an empty string when the name does not
+// start with a known verb followed by an object.
+func describeAction(name string) string {
+	words := strings.Fields(humanizeIdentifier(name))
+	if len(words) < 2 {
+		return ""
+	}
+
+	verb, object := strings.ToLower(words[0]), strings.Join(words[1:], " ")
+	switch verb {
+	case "is", "has", "can":
+		return "reports whether it " + verb + " " + object
+	}
+	if action, ok := actionVerbs[verb]; ok {
+		return action + " the " + object
+	}
+	return ""
+}
+
+// typeData is the data of the type.tmpl template.
+type typeData struct {
+	Name    string
+	Private string
+	// Kind is the kind of the type: "alias", "struct", "interface",
+	// "constraint", "func", "chan", "map", "slice", "array" or "defined".
+	Kind string
+	// Type is the aliased type of an alias, and the type a defined type is
+	// based on, and Underlying its underlying type when it differs.
+	Type       string
+	Underlying string
+	// Fields are the fields of a struct, the pointers being the
+	// OptionalFields.
+	Fields         []string
+	OptionalFields []string
+	// Methods are the methods of an interface, and Terms the types of the
+	// type set of a constraint.
+	Methods []string
+	Terms   []string
+	// Embedded are the types embedded in a struct or an interface.
+	Embedded []string
+	// MethodSet are the methods of the type, in the type-checked mode.
+	MethodSet []string
+	// Params, Results and ReturnsError describe a function type.
+	Params       []provider.Field
+	Results      []string
+	ReturnsError bool
+	// Dir is the direction of a channel, "send-only " or "receive-only ".
+	Dir string
+	// Key and Elem are the types of the keys and of the elements of a map,
+	// a slice, an array or a channel, and Len the length of an array.
+	Key        string
+	Elem       string
+	Len        string
+	TypeParams []typeParamData
+}
 
-			for i, param := range fn.Type.Params.List {
-				if i > 0 {
-					txt += ", "
+// typeParamData is a type parameter of a generic type.
+type typeParamData struct {
+	Name       string
+	Constraint string
+}
+
+func (d *defaultProcess) commentType(decl provider.Decl) (string, error) {
+	typeSpec := decl.Node.(*ast.TypeSpec)
+
+	data := typeData{
+		Name:       typeSpec.Name.Name,
+		Private:    privateTxt(typeSpec.Name.IsExported()),
+		TypeParams: typeParams(typeSpec.TypeParams),
+	}
+
+	if typeSpec.Assign.IsValid() {
+		data.Kind = "alias"
+		data.Type = getTypeName(typeSpec.Type)
+		return d.render(data, "type.tmpl")
+	}
+
+	switch t := typeSpec.Type.(type) {
+	case *ast.StructType:
+		data.Kind = "struct"
+		for _, field := range t.Fields.List {
+			if len(field.Names) == 0 {
+				if name := embeddedName(field.Type); name != "" {
+					data.Embedded = append(data.Embedded, name)
 				}
-				for _, name := range param.Names {
-					inputs = append(inputs, param.Type)
-					txt += fmt.Sprintf("%s %s of type %s", indefiniteArticle(fmt.Sprintf("%s", name.Name)), name.Name, getTypeName(param.Type))
+				continue
+			}
+			for _, name := range field.Names {
+				if _, isPointer := field.Type.(*ast.StarExpr); isPointer {
+					data.OptionalFields = append(data.OptionalFields, name.Name)
+				} else {
+					data.Fields = append(data.Fields, name.Name)
 				}
 			}
 		}
-
-		if fn.Type.Results != nil && len(fn.Type.Results.List) != 0 {
-			errorReturnMsg := ""
-			for i, res := range fn.Type.Results.List {
-				typeReturnKey := fmt.Sprintf("%s", res.Type)
-				if typeReturnKey == "error" {
-					errorReturnMsg = ".\n// It's return an error if fails, otherwise nil"
-					outputs = append(outputs, res.Type)
-				} else {
-					if i > 0 {
-						txt += " and "
-					} else {
-						txt += "\n// and returns "
-					}
-					outputs = append(outputs, res.Type)
-					txt += fmt.Sprintf("%s %s", indefiniteArticle(fmt.Sprintf("%s", res.Type)), res.Type)
+	case *ast.InterfaceType:
+		data.Kind = "interface"
+		for _, method := range t.Methods.List {
+			switch {
+			case len(method.Names) > 0:
+				for _, methodName := range method.Names {
+					data.Methods = append(data.Methods, methodName.Name)
 				}
+			case embeddedName(method.Type) != "":
+				data.Embedded = append(data.Embedded, getTypeName(method.Type))
+			default:
+				data.Terms = append(data.Terms, typeSetTerms(method.Type)...)
 			}
-			txt += errorReturnMsg
 		}
-		txt += ".\n"
+		if len(data.Terms) > 0 {
+			data.Kind = "constraint"
+		}
+	case *ast.FuncType:
+		data.Kind = "func"
+		data.Params = fieldsOf(t.Params)
+		data.Results, data.ReturnsError = resultsOf(t.Results)
+	case *ast.ChanType:
+		data.Kind = "chan"
+		data.Elem = getTypeName(t.Value)
+		switch t.Dir {
+		case ast.SEND:
+			data.Dir = "send-only "
+		case ast.RECV:
+			data.Dir = "receive-only "
+		}
+	case *ast.MapType:
+		data.Kind = "map"
+		data.Key, data.Elem = getTypeName(t.Key), getTypeName(t.Value)
+	case *ast.ArrayType:
+		data.Kind, data.Elem = "array", getTypeName(t.Elt)
+		if t.Len == nil {
+			data.Kind = "slice"
+		} else if length, ok := t.Len.(*ast.BasicLit); ok {
+			data.Len = length.Value
+		}
+	default:
+		data.Kind = "defined"
+		data.Type = getTypeName(t)
+		if underlying := d.types.underlying(t); underlying != data.Type {
+			data.Underlying = underlying
+		}
 	}
 
-	txt += d.exampleGenerator(fn.Name.Name, inputs, outputs)
+	data.MethodSet = d.types.methods(typeSpec.Name)
 
-	return txt, nil
+	return d.render(data, "type.tmpl")
 }
 
-func (d *defaultProcess) commentConst(name string, exported bool) (string, error) {
-	var exportedTxt string
-	if !exported {
-		exportedTxt = "private "
+// typeSetTerms returns the terms of a type set element like "~int | ~float64".
+func typeSetTerms(expr ast.Expr) []string {
+	switch t := expr.(type) {
+	case *ast.BinaryExpr:
+		return append(typeSetTerms(t.X), typeSetTerms(t.Y)...)
+	case *ast.UnaryExpr:
+		return []string{t.Op.String() + getTypeName(t.X)}
+	default:
+		return []string{getTypeName(t)}
 	}
-	explainConst := convertVarToCamelCaseTo(name)
-	txt := fmt.Sprintf("// %s is a %sconstant%s.", name, exportedTxt, explainConst)
-
-	return txt, nil
 }
 
-func (d *defaultProcess) commentVar(name, declType, explainVar string, exported bool) (string, error) {
-	var exportedTxt string
-	if !exported {
-		exportedTxt = "private "
+// typeParams returns the type parameters of a generic type or function.
+func typeParams(list *ast.FieldList) []typeParamData {
+	if list == nil {
+		return nil
 	}
-	txt := fmt.Sprintf("// %s is a %svariable of type %s%s.", name, exportedTxt, declType, explainVar)
 
-	return txt, nil
+	var params []typeParamData
+	for _, param := range list.List {
+		constraint := strings.Join(typeSetTerms(param.Type), " | ")
+		for _, name := range param.Names {
+			params = append(params, typeParamData{Name: name.Name, Constraint: constraint})
+		}
+	}
+	return params
 }
 
-func (d *defaultProcess) commentType(genDecl *ast.GenDecl) (string, error) {
-	return "", nil
+// fields returns the parameters of a function, with their resolved types.
+func (d *defaultProcess) fields(list *ast.FieldList) []provider.Field {
+	if list == nil {
+		return nil
+	}
+
+	var fields []provider.Field
+	for _, field := range list.List {
+		typ := d.types.typeString(field.Type)
+		if len(field.Names) == 0 {
+			fields = append(fields, provider.Field{Type: typ})
+		}
+		for _, name := range field.Names {
+			fields = append(fields, provider.Field{Name: name.Name, Type: typ})
+		}
+	}
+	return fields
 }
 
-func (d *defaultProcess) newFuncTxt(fn *ast.FuncDecl) string {
-	instanceReturnMsg := ""
-	initializesMsg := ""
-	errorReturnMsg := ""
-	if fn.Type.Results != nil {
-		if len(fn.Type.Results.List) != 0 {
-			for i, res := range fn.Type.Results.List {
-				typeReturnKey := fmt.Sprintf("%s", res.Type)
-				if typeReturnKey != "error" {
-					if i > 0 {
-						instanceReturnMsg += " and "
-					} else if i == 0 {
-						instanceReturnMsg += " of "
-						initializesMsg = typeReturnKey
-					}
-					instanceReturnMsg += typeReturnKey
+// fieldsOf returns the parameters of a function type as written.
+func fieldsOf(list *ast.FieldList) []provider.Field {
+	return (&defaultProcess{}).fields(list)
+}
 
-				} else {
-					errorReturnMsg = "// It's return an error if the initialization fails, otherwise nil.\n"
-				}
-			}
+// resultsOf returns the types of the results of a function type other than
+// the errors, and whether it returns an error.
+func resultsOf(list *ast.FieldList) (results []string, returnsError bool) {
+	for _, field := range fieldsOf(list) {
+		if field.Type == "error" {
+			returnsError = true
+			continue
 		}
+		results = append(results, field.Type)
 	}
+	return results, returnsError
+}
 
-	txt := fmt.Sprintf("// %s creates a new instance%s.\n", fn.Name.Name, instanceReturnMsg)
-	if (fn.Type.Params == nil || len(fn.Type.Params.List) == 0) && (fn.Type.Results == nil || len(fn.Type.Results.List) == 0) {
-	} else {
-		if fn.Type.Params != nil {
-			if len(fn.Type.Params.List) != 0 {
-				txt += fmt.Sprintf("// It initializes the %s with the provided ", initializesMsg)
-			}
+// valueData is the data of the var.tmpl and const.tmpl templates.
+type valueData struct {
+	Name string
+	// Names are the names of a block of constants, commented at once.
+	Names   []string
+	Private string
+	Type    string
+	// Description is the humanized name, like "default level", or is empty
+	// for the names of a single word.
+	Description string
+	// Error tells whether the value is a sentinel error, like "ErrNotFound",
+	// whose Description is then the name without its prefix, like "not
+	// found".
+	Error bool
+}
 
-			for i, param := range fn.Type.Params.List {
-				if i > 0 {
-					txt += ", "
-				}
-				for _, name := range param.Names {
-					txt += fmt.Sprintf("%s of type %s", name.Name, getTypeName(param.Type))
-				}
-			}
+func (d *defaultProcess) commentConst(decl provider.Decl) (string, error) {
+	return d.render(newValueData(decl), "const.tmpl")
+}
+
+func (d *defaultProcess) commentVar(decl provider.Decl) (string, error) {
+	return d.render(newValueData(decl), "var.tmpl")
+}
+
+// newValueData returns the template data of a variable or a constant.
+func newValueData(decl provider.Decl) valueData {
+	data := valueData{
+		Name:    decl.Name,
+		Private: privateTxt(decl.Exported),
+		Type:    decl.Type,
+	}
+	if _, ok := decl.Node.(*ast.GenDecl); ok {
+		data.Names = strings.Split(decl.Name, ", ")
+		return data
+	}
+	description := humanizeIdentifier(decl.Name)
+	if decl.Kind == provider.KindVar && sentinelRegexp.MatchString(decl.Name) {
+		data.Error = true
+		_, description, _ = strings.Cut(description, " ")
+		data.Description = description
+	} else if strings.Contains(description, " ") {
+		data.Description = description
+	}
+	return data
+}
+
+// fieldData is the data of the field.tmpl template.
+type fieldData struct {
+	// Parent is the struct of the field.
+	Parent string
+	// Names are the names declared by the field, and Description their
+	// humanized names.
+	Names       []string
+	Description string
+	Type        string
+	// Optional tells whether the field is a pointer.
+	Optional bool
+	// Nested tells whether the field is an anonymous struct.
+	Nested bool
+	// Embedded is the name of an embedded type.
+	Embedded string
+	Tags     []tagData
+}
+
+// tagData is the encoding of a field according to a struct tag.
+type tagData struct {
+	// Encoding is "JSON", "YAML" or "XML".
+	Encoding string
+	Name     string
+	// Ignored tells whether the field is ignored with "-".
+	Ignored bool
+}
+
+func (d *defaultProcess) commentField(decl provider.Decl) (string, error) {
+	field := decl.Node.(*ast.Field)
+	data := fieldData{Parent: decl.Parent}
+
+	if len(field.Names) == 0 {
+		data.Embedded = embeddedName(field.Type)
+		if data.Embedded == "" {
+			return "", nil
 		}
-		txt += ".\n"
+		return d.render(data, "field.tmpl")
 	}
-	if errorReturnMsg != "" {
-		txt += errorReturnMsg
+
+	explains := make([]string, len(field.Names))
+	for i, name := range field.Names {
+		data.Names = append(data.Names, name.Name)
+		explains[i] = humanizeIdentifier(name.Name)
+	}
+	data.Description = joinWords(explains)
+	data.Type = getTypeName(field.Type)
+	data.Nested = nestedStruct(field.Type) != nil
+	_, data.Optional = field.Type.(*ast.StarExpr)
+	if field.Tag != nil {
+		data.Tags = tags(field.Tag.Value)
 	}
 
-	return txt
+	return d.render(data, "field.tmpl")
 }
 
-func (d *defaultProcess) exampleGenerator(funcName string, inputs []ast.Expr, outputs []ast.Expr) string {
-	if !d.activeExamples {
-		return ""
-	} else if len(inputs) == 0 && len(outputs) == 0 {
-		return ""
+// methodData is the data of the interface-method.tmpl template.
+type methodData struct {
+	// Parent is the interface of the method.
+	Parent string
+	Name   string
+	// Embedded is the name of an embedded interface.
+	Embedded     string
+	Action       string
+	Params       []provider.Field
+	Results      []string
+	ReturnsError bool
+}
+
+func (d *defaultProcess) commentMethod(decl provider.Decl) (string, error) {
+	method := decl.Node.(*ast.Field)
+	data := methodData{Parent: decl.Parent}
+
+	if len(method.Names) == 0 {
+		data.Embedded = embeddedName(method.Type)
+		return d.render(data, "interface-method.tmpl")
 	}
 
-	exampleComment := "//\n// Example:\n//   "
+	fn, ok := method.Type.(*ast.FuncType)
+	if !ok {
+		return "", nil
+	}
+
+	data.Name = method.Names[0].Name
+	data.Action = describeAction(data.Name)
+	data.Params = fieldsOf(fn.Params)
+	data.Results, data.ReturnsError = resultsOf(fn.Results)
+
+	return d.render(data, "interface-method.tmpl")
+}
 
-	hasError := false
+// exampleGenerator returns the lines of an example call of fn, or nothing
+// when the examples are disabled or when the types of its parameters or its
+// results are not simple enough.
+func (d *defaultProcess) exampleGenerator(fn *ast.FuncDecl) []string {
+	if !d.activeExamples {
+		return nil
+	}
+
+	var inputs, outputs []ast.Expr
+	if fn.Type.Params != nil {
+		for _, param := range fn.Type.Params.List {
+			for range param.Names {
+				inputs = append(inputs, param.Type)
+			}
+		}
+	}
+	if fn.Type.Results != nil {
+		for _, res := range fn.Type.Results.List {
+			for i := 0; i < max(len(res.Names), 1); i++ {
+				outputs = append(outputs, res.Type)
+			}
+		}
+	}
+	if len(inputs) == 0 && len(outputs) == 0 {
+		return nil
+	}
 
+	var lines []string
 	if len(inputs) > 0 && detectExprTypeKey(inputs[0]) == "ctx" {
-		exampleComment += "ctx := context.Background()\n//   "
+		lines = append(lines, "ctx := context.Background()")
 	}
 
-	outputsStr := make([]string, len(outputs))
-	var outputsStrWithoutErrors []string
+	var (
+		call     string
+		hasError bool
+		printed  []string
+	)
 	if len(outputs) > 0 {
+		keys := make([]string, len(outputs))
 		for i, output := range outputs {
-			exprType := detectExprTypeKey(output)
-			if exprType == "unknown" {
-				return ""
-			} else if exprType == "err" {
+			keys[i] = detectExprTypeKey(output)
+			switch keys[i] {
+			case "unknown":
+				return nil
+			case "err":
 				hasError = true
-			} else {
-				outputsStrWithoutErrors = append(outputsStrWithoutErrors, fmt.Sprintf("%v", exprType))
+			default:
+				printed = append(printed, keys[i])
 			}
-			outputsStr[i] = fmt.Sprintf("%v", exprType)
 		}
-		exampleComment += strings.Join(outputsStr, ", ")
-		exampleComment += " := "
+		call = strings.Join(keys, ", ") + " := "
 	}
 
-	exampleComment += funcName + "("
+	if fn.Recv != nil && len(fn.Recv.List) > 0 && len(fn.Recv.List[0].Names) > 0 {
+		call += fn.Recv.List[0].Names[0].Name + "."
+	}
 
-	inputsStr := make([]string, len(inputs))
+	args := make([]string, len(inputs))
 	for i, input := range inputs {
-		exprType := detectExprTypeValue(input)
-		if exprType == "unknown" {
-			return ""
+		args[i] = detectExprTypeValue(input)
+		if args[i] == "unknown" {
+			return nil
 		}
-		inputsStr[i] = fmt.Sprintf("%s", exprType)
 	}
-	exampleComment += strings.Join(inputsStr, ", ")
-	exampleComment += ")\n"
+	lines = append(lines, call+fn.Name.Name+"("+strings.Join(args, ", ")+")")
 
 	if hasError {
-		exampleComment += "//   if err != nil {\n//       log.Fatalf(\"Error: %v\", err)\n//   }\n"
+		lines = append(lines, "if err != nil {", "    log.Fatalf(\"Error: %v\", err)", "}")
 	}
-
-	lenOutputs := len(outputsStrWithoutErrors)
-	if lenOutputs > 0 {
-		exampleComment += "//   fmt.Printf(\"" + generatePrintfFormat(lenOutputs) + "\", " + strings.Join(outputsStrWithoutErrors, ", ") + ")\n"
+	if len(printed) > 0 {
+		lines = append(lines, "fmt.Printf(\""+generatePrintfFormat(len(printed))+"\\n\", "+strings.Join(printed, ", ")+")")
 	}
-	return exampleComment
+	return lines
 }
 
 func generatePrintfFormat(sliceLength int) string {
 	if sliceLength <= 0 {
 		return ""
 	}
-	return strings.Repeat("%v ", sliceLength)
+	return strings.TrimSuffix(strings.Repeat("%v ", sliceLength), " ")
 }
 
 func detectExprTypeKey(expr ast.Expr) string {
@@ -259,12 +626,11 @@ func detectExprTypeKey(expr ast.Expr) string {
 		case "Context":
 			return "ctx"
 		default:
-			fmt.Println(fmt.Sprintf("detectExprTypeKey : %+v", v))
 			return "unknown"
 		}
 	case *ast.SelectorExpr:
 		// handle qualified types like "pkg.Type"
-		return detectExprTypeValue(v.Sel)
+		return detectExprTypeKey(v.Sel)
 	default:
 		return "unknown"
 	}
@@ -279,7 +645,7 @@ func detectExprTypeValue(expr ast.Expr) string {
 		case "int":
 			return "50"
 		case "string":
-			return "my-string"
+			return "\"my-string\""
 		case "float32":
 			return "56.32"
 		case "float64":
@@ -289,7 +655,6 @@ func detectExprTypeValue(expr ast.Expr) string {
 		case "Context":
 			return "ctx"
 		default:
-			fmt.Println(fmt.Sprintf("%+v", v))
 			return "unknown"
 		}
 	case *ast.SelectorExpr:
@@ -299,3 +664,55 @@ func detectExprTypeValue(expr ast.Expr) string {
 		return "unknown"
 	}
 }
+
+// privateTxt returns "private " for the unexported declarations.
+func privateTxt(exported bool) string {
+	if exported {
+		return ""
+	}
+	return "private "
+}
+
+// receiverTxt describes the type a method belongs to, like "the Client
+// struct" or "the Set map".
+func receiverTxt(decl provider.Decl) string {
+	if decl.Parent == "" {
+		return ""
+	}
+
+	kind := decl.ParentKind
+	if kind == "" {
+		kind = "type"
+	}
+	return "the " + decl.Parent + " " + kind
+}
+
+// tags returns how a field is encoded according to its json, yaml and xml
+// struct tags.
+func tags(rawTag string) []tagData {
+	value, err := strconv.Unquote(rawTag)
+	if err != nil {
+		return nil
+	}
+
+	tag := reflect.StructTag(value)
+
+	var tags []tagData
+	for _, encoding := range []string{"json", "yaml", "xml"} {
+		key, ok := tag.Lookup(encoding)
+		if !ok {
+			continue
+		}
+
+		name, _, _ := strings.Cut(key, ",")
+		switch name {
+		case "-":
+			tags = append(tags, tagData{Encoding: strings.ToUpper(encoding), Ignored: true})
+		case "":
+		default:
+			tags = append(tags, tagData{Encoding: strings.ToUpper(encoding), Name: name})
+		}
+	}
+
+	return tags
+}
@@ -0,0 +1,119 @@
+package comments
+
+import (
+	"testing"
+)
+
+func TestDefaultCommentTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "map",
+			src:  "type Set map[string]struct{}",
+			want: "// Set is a map of string keys to struct{} values.",
+		},
+		{
+			name: "slice",
+			src:  "type List []int",
+			want: "// List is a slice of int values.",
+		},
+		{
+			name: "func type",
+			src:  "type Handler func(w io.Writer, r *Request) error",
+			want: "// Handler is a function type.\n// It takes w of type io.Writer and r of type *Request.\n// It returns an error if it fails.",
+		},
+		{
+			name: "channel",
+			src:  "type Events <-chan Event",
+			want: "// Events is a receive-only channel of Event values.",
+		},
+		{
+			name: "constraint",
+			src:  "type Number interface {\n\t~int | ~float64\n}",
+			want: "// Number is a constraint satisfied by the types ~int and ~float64.",
+		},
+		{
+			name: "generic struct",
+			src:  "type Pair[K comparable, V any] struct {\n\t// Key is the key.\n\tKey K\n\t// Val is the value.\n\tVal V\n}",
+			want: "// Pair represents a structure.\n// It holds the Key and Val fields.\n// It is generic over K constrained by comparable and V constrained by any.",
+		},
+		{
+			name: "alias",
+			src:  "type Alias = Set",
+			want: "// Alias is an alias for the Set type.\n// Both names denote the same type, so no conversion is needed between them.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, "")
+			src := "package a\n\n" + tt.src + "\n"
+			want := "package a\n\n" + tt.want + "\n" + tt.src + "\n"
+			if got := processTest(t, dir, src); got != want {
+				t.Errorf("Process() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestDefaultCommentFuncs(t *testing.T) {
+	tests := []struct {
+		name  string
+		types string
+		src   string
+		want  string
+	}{
+		{
+			name:  "method of a map",
+			types: "// Set is a set.\ntype Set map[string]struct{}\n\n",
+			src:   "func (s Set) Has(key string) bool { return false }",
+			want:  "// Has is a method of the Set map.\n// It takes key of type string and returns a bool.",
+		},
+		{
+			name:  "method of a slice",
+			types: "// List is a list.\ntype List []int\n\n",
+			src:   "func (l List) Len() int { return len(l) }",
+			want:  "// Len is a method of the List slice.\n// It returns an int.",
+		},
+		{
+			name:  "method of a struct",
+			types: "// Client is a client.\ntype Client struct{}\n\n",
+			src:   "func (c *Client) Close() {}",
+			want:  "// Close is a method of the Client struct.\n// It does not take any arguments.",
+		},
+		{
+			name: "method of a type declared elsewhere",
+			src:  "func (o Other) Do() {}",
+			want: "// Do is a method of the Other type.\n// It does not take any arguments.",
+		},
+		{
+			name: "generic function",
+			src:  "func Map[T, U any](values []T, fn func(T) U) []U { return nil }",
+			want: "// Map is a function.\n// It is generic over T constrained by any and U constrained by any.\n// It takes values of type []T and fn of type func(T) U and returns an []U.",
+		},
+		{
+			name: "errors and panic",
+			src:  "func Get(key string) (string, error) {\n\tif key == \"\" {\n\t\treturn \"\", ErrEmptyKey\n\t}\n\tif len(key) > 9 {\n\t\tpanic(\"long\")\n\t}\n\treturn key, nil\n}",
+			want: "// Get is a function.\n// It takes key of type string and returns a string.\n// It returns ErrEmptyKey if key == \"\".\n// It may panic.",
+		},
+		{
+			name: "panic without error",
+			src:  "func Must(key string) string {\n\tif key == \"\" {\n\t\tpanic(\"empty\")\n\t}\n\treturn key\n}",
+			want: "// Must is a function.\n// It takes key of type string and returns a string.\n// It may panic.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, "")
+			src := "package a\n\n" + tt.types + tt.src + "\n"
+			want := "package a\n\n" + tt.types + tt.want + "\n" + tt.src + "\n"
+			if got := processTest(t, dir, src); got != want {
+				t.Errorf("Process() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package comments
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// ioFuncs are the functions and methods performing I/O, by kind of I/O. The
+// functions are named by the import path of their package and their name,
+// like "os.ReadFile", the methods by the import path of the package of their
+// receiver, its type name and their name, like "database/sql.DB.Query".
+// Calls outside the list, like os.Getenv or http.NewRequest, do not count.
+var ioFuncs = map[string]string{
+	// File system
+	"os.Chmod":             "file system",
+	"os.Chown":             "file system",
+	"os.Chtimes":           "file system",
+	"os.Create":            "file system",
+	"os.CreateTemp":        "file system",
+	"os.Link":              "file system",
+	"os.Lstat":             "file system",
+	"os.Mkdir":             "file system",
+	"os.MkdirAll":          "file system",
+	"os.MkdirTemp":         "file system",
+	"os.Open":              "file system",
+	"os.OpenFile":          "file system",
+	"os.ReadDir":           "file system",
+	"os.ReadFile":          "file system",
+	"os.Readlink":          "file system",
+	"os.Remove":            "file system",
+	"os.RemoveAll":         "file system",
+	"os.Rename":            "file system",
+	"os.Stat":              "file system",
+	"os.Symlink":           "file system",
+	"os.Truncate":          "file system",
+	"os.WriteFile":         "file system",
+	"os.File.Close":        "file system",
+	"os.File.Read":         "file system",
+	"os.File.ReadAt":       "file system",
+	"os.File.ReadDir":      "file system",
+	"os.File.ReadFrom":     "file system",
+	"os.File.Readdir":      "file system",
+	"os.File.Readdirnames": "file system",
+	"os.File.Seek":         "file system",
+	"os.File.Stat":         "file system",
+	"os.File.Sync":         "file system",
+	"os.File.Truncate":     "file system",
+	"os.File.Write":        "file system",
+	"os.File.WriteAt":      "file system",
+	"os.File.WriteString":  "file system",
+	"io/ioutil.ReadDir":    "file system",
+	"io/ioutil.ReadFile":   "file system",
+	"io/ioutil.TempDir":    "file system",
+	"io/ioutil.TempFile":   "file system",
+	"io/ioutil.WriteFile":  "file system",
+	// Network
+	"net.Dial":                          "network",
+	"net.DialTCP":                       "network",
+	"net.DialTimeout":                   "network",
+	"net.DialUDP":                       "network",
+	"net.DialUnix":                      "network",
+	"net.Listen":                        "network",
+	"net.ListenPacket":                  "network",
+	"net.ListenTCP":                     "network",
+	"net.ListenUDP":                     "network",
+	"net.LookupAddr":                    "network",
+	"net.LookupCNAME":                   "network",
+	"net.LookupHost":                    "network",
+	"net.LookupIP":                      "network",
+	"net.LookupMX":                      "network",
+	"net.LookupTXT":                     "network",
+	"net.Conn.Read":                     "network",
+	"net.Conn.Write":                    "network",
+	"net.Dialer.Dial":                   "network",
+	"net.Dialer.DialContext":            "network",
+	"net.Listener.Accept":               "network",
+	"net/http.Get":                      "network",
+	"net/http.Head":                     "network",
+	"net/http.ListenAndServe":           "network",
+	"net/http.ListenAndServeTLS":        "network",
+	"net/http.Post":                     "network",
+	"net/http.PostForm":                 "network",
+	"net/http.Serve":                    "network",
+	"net/http.ServeTLS":                 "network",
+	"net/http.Client.Do":                "network",
+	"net/http.Client.Get":               "network",
+	"net/http.Client.Head":              "network",
+	"net/http.Client.Post":              "network",
+	"net/http.Client.PostForm":          "network",
+	"net/http.Server.ListenAndServe":    "network",
+	"net/http.Server.ListenAndServeTLS": "network",
+	"net/http.Server.Serve":             "network",
+	"net/http.Server.ServeTLS":          "network",
+	"net/http.Server.Shutdown":          "network",
+	// Database
+	"database/sql.Conn.ExecContext":     "database",
+	"database/sql.Conn.PingContext":     "database",
+	"database/sql.Conn.PrepareContext":  "database",
+	"database/sql.Conn.QueryContext":    "database",
+	"database/sql.Conn.QueryRowContext": "database",
+	"database/sql.DB.Begin":             "database",
+	"database/sql.DB.BeginTx":           "database",
+	"database/sql.DB.Conn":              "database",
+	"database/sql.DB.Exec":              "database",
+	"database/sql.DB.ExecContext":       "database",
+	"database/sql.DB.Ping":              "database",
+	"database/sql.DB.PingContext":       "database",
+	"database/sql.DB.Prepare":           "database",
+	"database/sql.DB.PrepareContext":    "database",
+	"database/sql.DB.Query":             "database",
+	"database/sql.DB.QueryContext":      "database",
+	"database/sql.DB.QueryRow":          "database",
+	"database/sql.DB.QueryRowContext":   "database",
+	"database/sql.Stmt.Exec":            "database",
+	"database/sql.Stmt.ExecContext":     "database",
+	"database/sql.Stmt.Query":           "database",
+	"database/sql.Stmt.QueryContext":    "database",
+	"database/sql.Stmt.QueryRow":        "database",
+	"database/sql.Stmt.QueryRowContext": "database",
+	"database/sql.Tx.Commit":            "database",
+	"database/sql.Tx.Exec":              "database",
+	"database/sql.Tx.ExecContext":       "database",
+	"database/sql.Tx.Prepare":           "database",
+	"database/sql.Tx.PrepareContext":    "database",
+	"database/sql.Tx.Query":             "database",
+	"database/sql.Tx.QueryContext":      "database",
+	"database/sql.Tx.QueryRow":          "database",
+	"database/sql.Tx.QueryRowContext":   "database",
+	"database/sql.Tx.Rollback":          "database",
+}
+
+// packageNames are the import paths assumed for the package names without
+// type information.
+var packageNames = map[string]string{
+	"os":     "os",
+	"ioutil": "io/ioutil",
+	"net":    "net",
+	"http":   "net/http",
+	"sql":    "database/sql",
+}
+
+// lockFact is a mutex locked by a function.
+type lockFact struct {
+	// Name is the mutex as written in the source, like "s.mu".
+	Name string
+	// Read tells whether it is read-locked with RLock.
+	Read bool
+	// Deferred tells whether it is unlocked by a deferred call, so held until
+	// the function returns.
+	Deferred bool
+}
+
+// effectFacts are the side effects and the concurrency primitives found in
+// the body of a function.
+type effectFacts struct {
+	// IO are the kinds of I/O performed, like "file system" or "network".
+	IO []string
+	// Goroutines tells whether the function starts goroutines.
+	Goroutines bool
+	// Sends tells whether the function sends on channels.
+	Sends bool
+	// Receives tells whether the function receives from channels.
+	Receives bool
+	// Locks are the mutexes locked by the function.
+	Locks []lockFact
+	// ChecksContext tells whether the function checks the cancellation of a
+	// context with Done or Err.
+	ChecksContext bool
+}
+
+// analyzeEffects walks the body of fn to find its I/O, the goroutines it
+// starts, its channel operations, its mutex use and its context cancellation
+// checks. Unlike for the errors, the nested function literals are walked,
+// as the goroutines and callbacks they define run on behalf of fn.
+func (t *typesInfo) analyzeEffects(fn *ast.FuncDecl) effectFacts {
+	var facts effectFacts
+	if fn.Body == nil {
+		return facts
+	}
+
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.GoStmt:
+			facts.Goroutines = true
+		case *ast.DeferStmt:
+			if sel, ok := node.Call.Fun.(*ast.SelectorExpr); ok && (sel.Sel.Name == "Unlock" || sel.Sel.Name == "RUnlock") && t.isMutex(sel.X) {
+				facts.deferUnlock(getTypeName(sel.X))
+			}
+		case *ast.SendStmt:
+			facts.Sends = true
+		case *ast.UnaryExpr:
+			if node.Op == token.ARROW {
+				facts.Receives = true
+			}
+		case *ast.CallExpr:
+			sel, ok := node.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if kind, ok := ioFuncs[t.calleeName(sel)]; ok {
+				facts.IO = appendUnique(facts.IO, kind)
+			}
+			switch sel.Sel.Name {
+			case "Lock", "RLock":
+				if t.isMutex(sel.X) {
+					facts.addLock(getTypeName(sel.X), sel.Sel.Name == "RLock")
+				}
+			case "Done", "Err":
+				if t.isContext(sel.X) {
+					facts.ChecksContext = true
+				}
+			}
+		}
+		return true
+	})
+
+	return facts
+}
+
+// addLock records the mutex name locked, read-locked if read.
+func (facts *effectFacts) addLock(name string, read bool) {
+	for _, lock := range facts.Locks {
+		if lock.Name == name {
+			return
+		}
+	}
+	facts.Locks = append(facts.Locks, lockFact{Name: name, Read: read})
+}
+
+// deferUnlock records the deferred unlock of the mutex name. The unlocks
+// deferred before the lock, like in a closure, are ignored.
+func (facts *effectFacts) deferUnlock(name string) {
+	for i := range facts.Locks {
+		if facts.Locks[i].Name == name {
+			facts.Locks[i].Deferred = true
+		}
+	}
+}
+
+// calleeName returns the name of the called function or method as in
+// ioFuncs, like "os.ReadFile" or "database/sql.DB.Query", or an empty string
+// if unknown. Without type information, only the functions qualified by a
+// well-known package name are resolved, not the methods.
+func (t *typesInfo) calleeName(sel *ast.SelectorExpr) string {
+	if t == nil {
+		if ident, ok := sel.X.(*ast.Ident); ok && packageNames[ident.Name] != "" {
+			return packageNames[ident.Name] + "." + sel.Sel.Name
+		}
+		return ""
+	}
+
+	if ident, ok := sel.X.(*ast.Ident); ok {
+		if pkgName, ok := t.info.Uses[ident].(*types.PkgName); ok {
+			return pkgName.Imported().Path() + "." + sel.Sel.Name
+		}
+	}
+
+	selection, ok := t.info.Selections[sel]
+	if !ok || selection.Kind() == types.FieldVal {
+		return ""
+	}
+	recv := selection.Obj().(*types.Func).Type().(*types.Signature).Recv()
+	if recv == nil {
+		return ""
+	}
+	typ := recv.Type()
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	named, ok := typ.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return ""
+	}
+	return named.Obj().Pkg().Path() + "." + named.Obj().Name() + "." + sel.Sel.Name
+}
+
+// isMutex tells whether expr is a sync.Mutex or a sync.RWMutex, or without
+// type information whether its name looks like a mutex, like "mu" or
+// "s.lock".
+func (t *typesInfo) isMutex(expr ast.Expr) bool {
+	if typ := t.typeOf(expr); typ != nil {
+		if ptr, ok := typ.(*types.Pointer); ok {
+			typ = ptr.Elem()
+		}
+		named, ok := typ.(*types.Named)
+		if !ok || named.Obj().Pkg() == nil {
+			return false
+		}
+		return named.Obj().Pkg().Path() == "sync" && strings.HasSuffix(named.Obj().Name(), "Mutex")
+	}
+
+	name := strings.ToLower(getTypeName(expr))
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name == "mu" || strings.Contains(name, "mutex") || strings.Contains(name, "lock")
+}
+
+// isContext tells whether expr is a context.Context, or without type
+// information whether it is named "ctx".
+func (t *typesInfo) isContext(expr ast.Expr) bool {
+	if typ := t.typeOf(expr); typ != nil {
+		named, ok := typ.(*types.Named)
+		return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "context" && named.Obj().Name() == "Context"
+	}
+
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == "ctx"
+}
+
+// describe returns the sentences describing the side effects and the
+// concurrency of the function, or nil if nothing was found.
+func (facts effectFacts) describe() []string {
+	var sentences []string
+
+	switch {
+	case len(facts.IO) > 0 && facts.ChecksContext:
+		sentences = append(sentences, "It performs "+joinWords(facts.IO)+" I/O and honours ctx cancellation.")
+	case len(facts.IO) > 0:
+		sentences = append(sentences, "It performs "+joinWords(facts.IO)+" I/O.")
+	case facts.ChecksContext:
+		sentences = append(sentences, "It honours ctx cancellation.")
+	}
+
+	if facts.Goroutines {
+		sentences = append(sentences, "It starts goroutines.")
+	}
+
+	switch {
+	case facts.Sends && facts.Receives:
+		sentences = append(sentences, "It sends on and receives from channels.")
+	case facts.Sends:
+		sentences = append(sentences, "It sends on channels.")
+	case facts.Receives:
+		sentences = append(sentences, "It receives from channels.")
+	}
+
+	for _, lock := range facts.Locks {
+		held := lock.Name
+		if lock.Read {
+			held += " for reading"
+		}
+		if lock.Deferred {
+			sentences = append(sentences, "It holds "+held+" until it returns.")
+		} else {
+			sentences = append(sentences, "It locks "+held+".")
+		}
+	}
+
+	return sentences
+}
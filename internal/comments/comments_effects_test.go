@@ -0,0 +1,157 @@
+package comments
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeEffects(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "file system",
+			src:  "func Load(name string) ([]byte, error) { return os.ReadFile(name) }",
+			want: []string{"It performs file system I/O."},
+		},
+		{
+			name: "no I/O in the I/O packages",
+			src: `func Config() string {
+	req, _ := http.NewRequest("GET", os.Getenv("URL"), nil)
+	return http.StatusText(200) + req.URL.Path
+}`,
+		},
+		{
+			name: "network and context",
+			src: `func Fetch(ctx context.Context, url string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	_, err := http.Get(url)
+	return err
+}`,
+			want: []string{"It performs network I/O and honours ctx cancellation."},
+		},
+		{
+			name: "goroutines and channels",
+			src: `func Run(ch chan int) {
+	go func() { ch <- 1 }()
+	<-ch
+}`,
+			want: []string{"It starts goroutines.", "It sends on and receives from channels."},
+		},
+		{
+			name: "lock held until return",
+			src: `func (c *Cache) Get(key string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.m[key]
+}`,
+			want: []string{"It holds c.mu for reading until it returns."},
+		},
+		{
+			name: "lock released in the body",
+			src: `func (c *Cache) Set(key, value string) {
+	c.mu.Lock()
+	c.m[key] = value
+	c.mu.Unlock()
+}`,
+			want: []string{"It locks c.mu."},
+		},
+		{
+			name: "lock of another name",
+			src: `func (c *Cache) Reset() {
+	c.door.Lock()
+}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parser.ParseFile(token.NewFileSet(), "a.go", "package a\n\n"+tt.src+"\n", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var types *typesInfo
+			got := types.analyzeEffects(f.Decls[0].(*ast.FuncDecl)).describe()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("describe() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeEffectsTyped(t *testing.T) {
+	const src = `package a
+
+import (
+	"database/sql"
+	"os"
+	"sync"
+)
+
+// Store is a store.
+type Store struct {
+	db   *sql.DB
+	f    *os.File
+	lock sync.Mutex
+}
+
+func (s *Store) Count() (n int, err error) {
+	err = s.db.QueryRow("SELECT 1").Scan(&n)
+	return n, err
+}
+
+func (s *Store) Append(p []byte) error {
+	_, err := s.f.Write(p)
+	return err
+}
+
+func (s *Store) Home() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return os.Getenv("HOME")
+}
+`
+
+	tests := []struct {
+		name    string
+		want    string
+		notWant string
+	}{
+		{
+			name: "database method",
+			want: "// It performs database I/O.\nfunc (s *Store) Count",
+		},
+		{
+			name: "file method",
+			want: "// It performs file system I/O.\nfunc (s *Store) Append",
+		},
+		{
+			name:    "lock and no I/O",
+			want:    "// It holds s.lock until it returns.\nfunc (s *Store) Home",
+			notWant: "I/O.\nfunc (s *Store) Home",
+		},
+	}
+
+	dir := testModule(t, "")
+	got := processTestOptions(t, dir, src, Options{Packages: NewPackageLoader()})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("Process() =\n%s\nwant it to contain\n%s", got, tt.want)
+			}
+			if tt.notWant != "" && strings.Contains(got, tt.notWant) {
+				t.Errorf("Process() =\n%s\nwant it not to contain\n%s", got, tt.notWant)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package comments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The default HTTP policy of the providers.
+const (
+	defaultHTTPTimeout      = 60 * time.Second
+	defaultHTTPMaxRetries   = 3
+	defaultHTTPBackoff      = 500 * time.Millisecond
+	defaultHTTPMaxBackoff   = 30 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// errCircuitOpen is returned without calling the provider while its circuit
+// breaker is open.
+var errCircuitOpen = errors.New("circuit breaker open after repeated failures")
+
+// HTTPConfig is the policy of the HTTP calls of a provider. The zero values
+// are replaced by the defaults.
+type HTTPConfig struct {
+	// Timeout is the maximum duration of each attempt, like "30s".
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxRetries is the number of retries after a network error, a 429 or a
+	// 5xx response. Set it to 0 to disable the retries.
+	MaxRetries *int `yaml:"max-retries"`
+	// Backoff is the delay before the first retry. It doubles on each retry,
+	// with a random jitter, up to MaxBackoff.
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max-backoff"`
+	// BreakerThreshold is the number of consecutive failed calls opening the
+	// circuit breaker: the provider is not called anymore during
+	// BreakerCooldown, then a single call is tried again.
+	BreakerThreshold int           `yaml:"breaker-threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker-cooldown"`
+}
+
+// Merge returns the policy overridden by the values set in newCfg.
+func (cfg HTTPConfig) Merge(newCfg HTTPConfig) HTTPConfig {
+	if newCfg.Timeout != 0 {
+		cfg.Timeout = newCfg.Timeout
+	}
+	if newCfg.MaxRetries != nil {
+		cfg.MaxRetries = newCfg.MaxRetries
+	}
+	if newCfg.Backoff != 0 {
+		cfg.Backoff = newCfg.Backoff
+	}
+	if newCfg.MaxBackoff != 0 {
+		cfg.MaxBackoff = newCfg.MaxBackoff
+	}
+	if newCfg.BreakerThreshold != 0 {
+		cfg.BreakerThreshold = newCfg.BreakerThreshold
+	}
+	if newCfg.BreakerCooldown != 0 {
+		cfg.BreakerCooldown = newCfg.BreakerCooldown
+	}
+	return cfg
+}
+
+// withDefaults returns the policy with the defaults of the unset values.
+func (cfg HTTPConfig) withDefaults() HTTPConfig {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultHTTPTimeout
+	}
+	if cfg.MaxRetries == nil {
+		maxRetries := defaultHTTPMaxRetries
+		cfg.MaxRetries = &maxRetries
+	}
+	if cfg.Backoff == 0 {
+		cfg.Backoff = defaultHTTPBackoff
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = defaultHTTPMaxBackoff
+	}
+	if cfg.BreakerThreshold == 0 {
+		cfg.BreakerThreshold = defaultBreakerThreshold
+	}
+	if cfg.BreakerCooldown == 0 {
+		cfg.BreakerCooldown = defaultBreakerCooldown
+	}
+	return cfg
+}
+
+// httpClient calls a provider API with the retry, backoff, timeout and
+// circuit breaker policy of its configuration.
+type httpClient struct {
+	cfg     HTTPConfig
+	client  *http.Client
+	breaker *circuitBreaker
+}
+
+// newHTTPClient returns the client of the provider API at url. The circuit
+// breaker is shared by all the clients of the same provider and url, as the
+// providers are instantiated for each file.
+func newHTTPClient(name, url string, cfg HTTPConfig) *httpClient {
+	cfg = cfg.withDefaults()
+	return &httpClient{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		breaker: sharedBreaker(name+" "+url, cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}
+}
+
+// do sends req, retrying it on the network errors, the 429 and the 5xx
+// responses. The other responses are returned to be handled by the caller,
+// who must close their body. The body of req must be replayable, like the
+// bodies of the requests created by http.NewRequest from a bytes.Buffer.
+// The calls interrupted by the cancellation or the deadline of ctx are not
+// counted by the circuit breaker, unlike the timeouts of the attempts.
+func (c *httpClient) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if !c.breaker.allow() {
+		return nil, errCircuitOpen
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req)
+
+		retryable, wait := c.retryable(resp, err, attempt)
+		if !retryable || attempt >= *c.cfg.MaxRetries {
+			switch {
+			case err != nil && ctx.Err() != nil:
+				c.breaker.release()
+			case err != nil || retryable:
+				c.breaker.failure()
+			default:
+				c.breaker.success()
+			}
+			return resp, err
+		}
+
+		// Drain the discarded response to reuse the connection.
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			c.breaker.release()
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send sends a copy of req with a fresh body.
+func (c *httpClient) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	attempt := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		attempt.Body = body
+	}
+
+	resp, err := c.client.Do(attempt)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return resp, err
+}
+
+// retryable tells whether the attempt must be retried and the delay before
+// the next attempt, from the Retry-After header or the exponential backoff.
+func (c *httpClient) retryable(resp *http.Response, err error, attempt int) (bool, time.Duration) {
+	switch {
+	case err != nil:
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false, 0
+		}
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return true, min(wait, c.cfg.MaxBackoff)
+		}
+	default:
+		return false, 0
+	}
+
+	backoff := c.cfg.Backoff << attempt
+	if backoff > c.cfg.MaxBackoff || backoff <= 0 {
+		backoff = c.cfg.MaxBackoff
+	}
+
+	// Full jitter between half and all of the backoff, so that the workers
+	// do not retry all at once.
+	return true, backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// retryAfter parses the value of a Retry-After header, either a number of
+// seconds or an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// circuitBreaker stops calling a provider after consecutive failures, until
+// a cooldown elapsed. It is safe for concurrent use.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[string]*circuitBreaker)
+)
+
+// sharedBreaker returns the circuit breaker of the given key, creating it on
+// the first call.
+func sharedBreaker(key string, threshold int, cooldown time.Duration) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	breaker, ok := breakers[key]
+	if !ok {
+		breaker = &circuitBreaker{
+			threshold: threshold,
+			cooldown:  cooldown,
+		}
+		breakers[key] = breaker
+	}
+	return breaker
+}
+
+// allow tells whether the provider may be called. Once the cooldown of an
+// open breaker elapsed, a single probing call is allowed.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// success closes the breaker.
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+}
+
+// release ends a call interrupted by its caller without counting it, so
+// that another call may probe an open breaker.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// failure counts a failed call, opening the breaker at the threshold.
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// statusError returns the error of an unexpected response status, with the
+// beginning of its body.
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, body)
+}
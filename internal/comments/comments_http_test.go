@@ -0,0 +1,194 @@
+package comments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testHTTPClient returns a client of server with fast retries, and a circuit
+// breaker of its own opening after threshold failures.
+func testHTTPClient(t *testing.T, server *httptest.Server, maxRetries, threshold int) *httpClient {
+	t.Helper()
+
+	return newHTTPClient(t.Name(), server.URL, HTTPConfig{
+		Timeout:          time.Second,
+		MaxRetries:       &maxRetries,
+		Backoff:          time.Millisecond,
+		MaxBackoff:       2 * time.Millisecond,
+		BreakerThreshold: threshold,
+		BreakerCooldown:  time.Hour,
+	})
+}
+
+// get sends a GET request to the server with c.
+func get(ctx context.Context, c *httpClient, server *httptest.Server) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestHTTPClientRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		maxRetries int
+		wantStatus int
+		wantCalls  int32
+	}{
+		{
+			name:       "success",
+			statuses:   []int{http.StatusOK},
+			maxRetries: 3,
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		{
+			name:       "server errors retried",
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			maxRetries: 3,
+			wantStatus: http.StatusOK,
+			wantCalls:  3,
+		},
+		{
+			name:       "too many requests with Retry-After",
+			statuses:   []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter: "0",
+			maxRetries: 3,
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:       "client error not retried",
+			statuses:   []int{http.StatusBadRequest, http.StatusOK},
+			maxRetries: 3,
+			wantStatus: http.StatusBadRequest,
+			wantCalls:  1,
+		},
+		{
+			name:       "retries exhausted",
+			statuses:   []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK},
+			maxRetries: 1,
+			wantStatus: http.StatusInternalServerError,
+			wantCalls:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.statuses[min(int(n), len(tt.statuses))-1])
+			}))
+			defer server.Close()
+
+			status, err := get(context.Background(), testHTTPClient(t, server, tt.maxRetries, 100), server)
+			if err != nil {
+				t.Fatalf("do() error = %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("do() status = %d, want %d", status, tt.wantStatus)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("%d calls, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestHTTPClientBreaker(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	c := testHTTPClient(t, server, 0, 2)
+
+	// The cancellation of the caller is not a failure of the provider.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		if _, err := get(ctx, c, server); !errors.Is(err, context.Canceled) {
+			t.Fatalf("do() error = %v, want %v", err, context.Canceled)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := get(context.Background(), c, server); err != nil {
+			t.Fatalf("do() error = %v", err)
+		}
+	}
+	if _, err := get(context.Background(), c, server); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("do() error = %v, want %v", err, errCircuitOpen)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("%d calls, want 2", got)
+	}
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	b := &circuitBreaker{threshold: 1, cooldown: time.Millisecond}
+
+	b.failure()
+	if b.allow() {
+		t.Fatal("allow() = true on an open breaker")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("allow() = false after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("allow() = true during the probing call")
+	}
+
+	// A probing call interrupted by its caller lets another call probe.
+	b.release()
+	if !b.allow() {
+		t.Fatal("allow() = false after a released probing call")
+	}
+
+	b.success()
+	if !b.allow() || !b.allow() {
+		t.Error("allow() = false on a closed breaker")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: ""},
+		{value: "3", want: 3 * time.Second, wantOK: true},
+		{value: "-1"},
+		{value: "soon"},
+		{value: "Mon, 02 Jan 2006 15:04:05 GMT", want: 0, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -1,44 +1,437 @@
 package comments
 
 import (
-	"go/ast"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/ariden/gocomments/provider"
 )
 
-type commentsProcess interface {
+// declCommenter is implemented by the built-in providers, which comment the
+// declarations one at a time.
+type declCommenter interface {
+	Name() string
+	commentConst(decl provider.Decl) (string, error)
+	commentFunc(ctx context.Context, decl provider.Decl) (string, error)
+	commentType(decl provider.Decl) (string, error)
+	commentVar(decl provider.Decl) (string, error)
+	commentField(decl provider.Decl) (string, error)
+	commentMethod(decl provider.Decl) (string, error)
+}
+
+// promptCommenter is implemented by the built-in AI providers, which comment
+// the declarations having a prompt, and the functions, with their model.
+type promptCommenter interface {
+	commentPrompt(ctx context.Context, prompt string) (provider.Comment, error)
+}
+
+// batchCommenter is implemented by the built-in AI providers able to comment
+// several declarations in a single request.
+type batchCommenter interface {
+	promptCommenter
+	// batchSize returns the largest number of prompts of a request, 1 when
+	// the declarations are commented one at a time.
+	batchSize() int
+	// commentPrompts returns the comments of the prompts, in the same order.
+	commentPrompts(ctx context.Context, prompts []string) ([]provider.Comment, error)
+}
+
+// commentDecls implements provider.Provider for the built-in providers by
+// commenting each declaration of the batch with c, with up to jobs requests
+// sent concurrently. When c is a batchCommenter, the declarations sent to
+// the model are grouped in requests of up to its batch size. The
+// declarations failing are left without comment, and only the cancellation
+// of ctx fails the batch.
+func commentDecls(ctx context.Context, c declCommenter, decls []provider.Decl, jobs int) ([]provider.Comment, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	var (
+		comments = make([]provider.Comment, len(decls))
+		errs     = make([]error, len(decls))
+		sem      = make(chan struct{}, jobs)
+		wg       sync.WaitGroup
+	)
+	for _, group := range groupDecls(c, decls) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(group []int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if len(group) == 1 {
+				i := group[0]
+				comments[i], errs[i] = commentDecl(ctx, c, decls[i])
+				return
+			}
+
+			prompts := make([]string, len(group))
+			for j, i := range group {
+				prompts[j] = declPrompt(decls[i])
+			}
+			results, err := c.(batchCommenter).commentPrompts(ctx, prompts)
+			for j, i := range group {
+				if err != nil {
+					errs[i] = fmt.Errorf("fail to add comments on %s %s: %v", decls[i].Kind, decls[i].Name, err)
+					continue
+				}
+				comments[i] = results[j]
+			}
+		}(group)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// A failed declaration is left without comment, to be commented by the
+	// next provider of the chain.
+	for _, err := range errs {
+		if err != nil {
+			log.Printf("fail to generate comments with the %s provider: %v", c.Name(), err)
+		}
+	}
+
+	return comments, nil
+}
+
+// groupDecls returns the indexes of decls grouped by request: the
+// declarations having a prompt are grouped by the batch size of c when it is
+// a batchCommenter, the other ones are alone in their group.
+func groupDecls(c declCommenter, decls []provider.Decl) [][]int {
+	size := 1
+	if bc, ok := c.(batchCommenter); ok {
+		size = bc.batchSize()
+	}
+
+	var groups [][]int
+	batch := -1
+	for i, decl := range decls {
+		if size <= 1 || declPrompt(decl) == "" {
+			groups = append(groups, []int{i})
+			continue
+		}
+		if batch < 0 || len(groups[batch]) == size {
+			batch = len(groups)
+			groups = append(groups, nil)
+		}
+		groups[batch] = append(groups[batch], i)
+	}
+	return groups
+}
+
+// declPrompt returns the prompt sent to the AI models for decl: its prompt,
+// or the default prompt of the functions without one, or an empty string
+// for the declarations commented offline.
+func declPrompt(decl provider.Decl) string {
+	if decl.Prompt != "" {
+		return decl.Prompt
+	}
+	if decl.Kind == provider.KindFunc || decl.Kind == provider.KindMethod {
+		return funcPrompt(decl)
+	}
+	return ""
+}
+
+// modelDecl reports whether c comments decl: the default provider comments
+// all the declarations, the promptCommenter providers the ones with a
+// prompt, and the other AI providers the functions and methods.
+func modelDecl(c declCommenter, decl provider.Decl) bool {
+	switch c.(type) {
+	case *defaultProcess:
+		return true
+	case promptCommenter:
+		return declPrompt(decl) != ""
+	}
+	return decl.Kind == provider.KindFunc || decl.Kind == provider.KindMethod
+}
+
+// commentDecl comments a single declaration with c. The promptCommenter
+// providers send its prompt to their model, if any. The declarations not
+// sent to the model of an AI provider are left without comment, for the
+// default provider ending the chain to comment them and be reported as
+// their producer.
+func commentDecl(ctx context.Context, c declCommenter, decl provider.Decl) (provider.Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return provider.Comment{}, err
+	}
+	if !modelDecl(c, decl) {
+		return provider.Comment{}, nil
+	}
+
+	if pc, ok := c.(promptCommenter); ok {
+		if prompt := declPrompt(decl); prompt != "" {
+			comment, err := pc.commentPrompt(ctx, prompt)
+			if err != nil {
+				return provider.Comment{}, fmt.Errorf("fail to add comments on %s %s: %v", decl.Kind, decl.Name, err)
+			}
+			return comment, nil
+		}
+	}
+
+	var (
+		txt string
+		err error
+	)
+
+	switch decl.Kind {
+	case provider.KindFunc, provider.KindMethod:
+		txt, err = c.commentFunc(ctx, decl)
+	case provider.KindType:
+		txt, err = c.commentType(decl)
+	case provider.KindConst:
+		txt, err = c.commentConst(decl)
+	case provider.KindVar:
+		txt, err = c.commentVar(decl)
+	case provider.KindField:
+		txt, err = c.commentField(decl)
+	case provider.KindInterfaceMethod:
+		txt, err = c.commentMethod(decl)
+	default:
+		err = fmt.Errorf("unknown declaration kind %q", decl.Kind)
+	}
+	if err != nil {
+		return provider.Comment{}, fmt.Errorf("fail to add comments on %s %s: %v", decl.Kind, decl.Name, err)
+	}
+
+	return parseComment(txt), nil
+}
+
+// parseComment turns the comment lines generated by the built-in providers
+// into a provider.Comment, the first line being the summary.
+func parseComment(txt string) provider.Comment {
+	txt = strings.TrimRight(txt, "\n")
+	if strings.TrimSpace(txt) == "" {
+		return provider.Comment{}
+	}
+
+	lines := strings.Split(txt, "\n")
+	for i, line := range lines {
+		if line, ok := strings.CutPrefix(line, "//"); ok {
+			lines[i] = strings.TrimPrefix(line, " ")
+		}
+	}
+
+	return provider.Comment{
+		Summary: lines[0],
+		Details: lines[1:],
+	}
+}
+
+// builtinProviders are the names of the built-in AI providers, in the order
+// they are chained when the configuration does not list the providers.
+var builtinProviders = []string{"localai", "ollama", "openai", "anthropic"}
+
+// builtinProvider is a provider configured in the CommentConfig.
+type builtinProvider interface {
+	provider.Provider
 	isActive() bool
-	commentConst(string, bool) (string, error)
-	commentFunc(fn *ast.FuncDecl) (string, error)
-	commentType(genDecl *ast.GenDecl) (string, error)
-	commentVar(name, declType, explainVar string, exported bool) (string, error)
+	checkConfig() error
 }
 
-func newProcessor(cfg *CommentConfig) commentsProcess {
-	if cfg == nil {
-		return &defaultProcess{
-			activeExamples: cfg.ActiveExamples,
+// cleanComment removes from the answer of a model the code fences and the
+// "//" prefixes it may have added despite the instructions.
+func cleanComment(answer string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(answer), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "//") {
+			line = strings.TrimPrefix(strings.TrimPrefix(trimmed, "//"), " ")
 		}
+		lines = append(lines, line)
 	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
 
-	localAIProcess := localAI{
-		LocalAIConfig: cfg.LocalAI,
+// newBuiltinProvider returns the built-in provider or the plugin with the
+// given name, or nil if there is none. The built-in AI providers embed base,
+// the default provider, for its settings. They and the plugins comment up to
+// jobs declarations concurrently.
+func newBuiltinProvider(name string, cfg *CommentConfig, base defaultProcess, jobs int) builtinProvider {
+	switch name {
+	case "default":
+		return &base
+	case "localai":
+		return &localAI{
+			LocalAIConfig:  cfg.LocalAI,
+			defaultProcess: base,
+			client:         newHTTPClient(name, cfg.LocalAI.URL, cfg.LocalAI.HTTP),
+		}
+	case "ollama":
+		return &ollama{
+			OllamaConfig:   cfg.Ollama,
+			defaultProcess: base,
+			client:         newHTTPClient(name, cfg.Ollama.URL, cfg.Ollama.HTTP),
+		}
+	case "openai":
+		return &openAI{
+			OpenAIConfig:   cfg.OpenAI,
+			defaultProcess: base,
+			client:         newHTTPClient(name, cfg.OpenAI.URL, cfg.OpenAI.HTTP),
+		}
+	case "anthropic":
+		return &anthropic{
+			AnthropicConfig: cfg.Anthropic,
+			defaultProcess:  base,
+			client:          newHTTPClient(name, cfg.Anthropic.URL, cfg.Anthropic.HTTP),
+		}
+	default:
+		if plugin, ok := cfg.plugin(name); ok {
+			return &pluginProvider{PluginConfig: plugin, jobs: jobs}
+		}
+		return nil
 	}
-	if localAIProcess.isActive() {
-		return &localAIProcess
+}
+
+// providerChain generates each comment with the first provider of the chain
+// giving one. A provider failing on the whole batch, or leaving some
+// declarations without comment, is followed by the next one.
+type providerChain struct {
+	providers []provider.Provider
+}
+
+// newProviderChain returns the chain of the providers listed in the
+// configuration, each one being a built-in provider, a plugin or a provider
+// registered with provider.Register. Without list, the active built-in AI
+// providers and plugins are chained. The default provider always ends the
+// chain. The comments of the other providers are cached in opts.Cache when
+// it is not nil and can be opened. In the offline mode, the other providers
+// are only read from the cache, and left out when it does not exist or when
+// their configuration is invalid.
+func newProviderChain(cfg *CommentConfig, info *typesInfo, opts Options) (*providerChain, error) {
+	jobs, cache := opts.Jobs, opts.Cache
+	if opts.Offline {
+		// Checking the model would send a request.
+		offline := *cfg
+		offline.Ollama.CheckModel = nil
+		cfg = &offline
 	}
 
-	openAIProcess := openAI{
-		OpenAIConfig: cfg.OpenAI,
+	templates, err := loadTemplates(cfg.Templates)
+	if err != nil {
+		return nil, fmt.Errorf("invalid templates: %v", err)
 	}
-	if openAIProcess.isActive() {
-		return &openAIProcess
+	base := defaultProcess{
+		activeExamples: cfg.ActiveExamples,
+		types:          info,
+		templates:      templates,
+		jobs:           jobs,
 	}
 
-	anthropicProcess := anthropic{
-		AnthropicConfig: cfg.Anthropic,
+	names := cfg.Providers
+	if len(names) == 0 {
+		for _, name := range builtinProviders {
+			if newBuiltinProvider(name, cfg, base, jobs).isActive() {
+				names = append(names, name)
+			}
+		}
+		for _, plugin := range cfg.Plugins {
+			if plugin.Active != nil && *plugin.Active {
+				names = append(names, plugin.Name)
+			}
+		}
 	}
-	if anthropicProcess.isActive() {
-		return &anthropicProcess
+
+	chain := &providerChain{}
+	for _, name := range names {
+		if opts.Offline && name != "default" && (cache == nil || !cache.exists()) {
+			continue
+		}
+
+		var p provider.Provider
+		if builtin := newBuiltinProvider(name, cfg, base, jobs); builtin != nil {
+			if err := builtin.checkConfig(); err != nil {
+				if opts.Offline {
+					continue
+				}
+				return nil, fmt.Errorf("invalid %s provider: %v", name, err)
+			}
+			p = builtin
+		} else if registered, ok := provider.Lookup(name); ok {
+			p = registered
+		} else {
+			return nil, fmt.Errorf("unknown provider %q, the registered providers are %v", name, provider.Names())
+		}
+
+		if name == "default" {
+			chain.providers = append(chain.providers, p)
+			return chain, nil
+		}
+		if cache != nil && cache.open() {
+			cp := newCachedProvider(p, cache, cfg.Prompts)
+			cp.offline = opts.Offline
+			p = cp
+		}
+		chain.providers = append(chain.providers, p)
+	}
+
+	chain.providers = append(chain.providers, newBuiltinProvider("default", cfg, base, jobs))
+	return chain, nil
+}
+
+// usesPrompts tells whether the chain has a provider other than the default
+// one ending it, the only provider which does not read the prompts. A nil
+// chain, like in check mode, uses none.
+func (c *providerChain) usesPrompts() bool {
+	return c != nil && len(c.providers) > 1
+}
+
+// comment returns the comments of decls and the names of the providers
+// which generated them, empty for the declarations left without comment.
+func (c *providerChain) comment(ctx context.Context, decls []provider.Decl) ([]provider.Comment, []string, error) {
+	comments := make([]provider.Comment, len(decls))
+	producers := make([]string, len(decls))
+
+	pending := make([]int, len(decls))
+	for i := range decls {
+		pending[i] = i
+	}
+
+	for _, p := range c.providers {
+		if len(pending) == 0 {
+			break
+		}
+
+		batch := make([]provider.Decl, len(pending))
+		for j, i := range pending {
+			batch[j] = decls[i]
+		}
+
+		results, err := p.Comment(ctx, batch)
+		if err == nil && len(results) != len(batch) {
+			err = fmt.Errorf("%d comments returned for %d declarations", len(results), len(batch))
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			log.Printf("fail to generate comments with the %s provider, trying the next one: %v", p.Name(), err)
+			continue
+		}
+
+		var next []int
+		for j, i := range pending {
+			if results[j].IsZero() {
+				next = append(next, i)
+				continue
+			}
+			comments[i] = results[j]
+			producers[i] = p.Name()
+		}
+		pending = next
 	}
 
-	return &defaultProcess{}
+	return comments, producers, nil
 }
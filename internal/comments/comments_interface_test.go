@@ -0,0 +1,406 @@
+package comments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ariden/gocomments/provider"
+)
+
+// fakeCommenter is a batchCommenter answering with the prompts. Its offline
+// comments "<kind> <name>" are never used, the declarations without prompt
+// being left to the default provider.
+type fakeCommenter struct {
+	size int
+	fail bool
+
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (c *fakeCommenter) Name() string { return "fake" }
+
+func (c *fakeCommenter) offline(decl provider.Decl) (string, error) {
+	return string(decl.Kind) + " " + decl.Name, nil
+}
+
+func (c *fakeCommenter) commentConst(decl provider.Decl) (string, error) { return c.offline(decl) }
+
+func (c *fakeCommenter) commentFunc(_ context.Context, decl provider.Decl) (string, error) {
+	return c.offline(decl)
+}
+
+func (c *fakeCommenter) commentType(decl provider.Decl) (string, error)   { return c.offline(decl) }
+func (c *fakeCommenter) commentVar(decl provider.Decl) (string, error)    { return c.offline(decl) }
+func (c *fakeCommenter) commentField(decl provider.Decl) (string, error)  { return c.offline(decl) }
+func (c *fakeCommenter) commentMethod(decl provider.Decl) (string, error) { return c.offline(decl) }
+
+func (c *fakeCommenter) batchSize() int { return c.size }
+
+func (c *fakeCommenter) commentPrompt(ctx context.Context, prompt string) (provider.Comment, error) {
+	comments, err := c.commentPrompts(ctx, []string{prompt})
+	if err != nil {
+		return provider.Comment{}, err
+	}
+	return comments[0], nil
+}
+
+func (c *fakeCommenter) commentPrompts(_ context.Context, prompts []string) ([]provider.Comment, error) {
+	c.mu.Lock()
+	c.batches = append(c.batches, prompts)
+	c.mu.Unlock()
+
+	if c.fail {
+		return nil, errors.New("model down")
+	}
+	comments := make([]provider.Comment, len(prompts))
+	for i, prompt := range prompts {
+		comments[i] = provider.Comment{
+			Summary: prompt,
+			Params:  []provider.ParamDoc{{Name: "x", Doc: "the x."}},
+		}
+	}
+	return comments, nil
+}
+
+func TestCommentDecls(t *testing.T) {
+	decls := []provider.Decl{
+		{Kind: provider.KindType, Name: "T", Prompt: "type T"},
+		{Kind: provider.KindConst, Name: "C"},
+		{Kind: provider.KindVar, Name: "V", Prompt: "var V"},
+		{Kind: provider.KindField, Name: "F", Prompt: "field F"},
+	}
+	withParams := func(summary string) provider.Comment {
+		return provider.Comment{Summary: summary, Params: []provider.ParamDoc{{Name: "x", Doc: "the x."}}}
+	}
+
+	tests := []struct {
+		name        string
+		size        int
+		fail        bool
+		wantBatches [][]string
+		want        []provider.Comment
+	}{
+		{
+			name:        "one at a time",
+			size:        1,
+			wantBatches: [][]string{{"type T"}, {"var V"}, {"field F"}},
+			want:        []provider.Comment{withParams("type T"), {}, withParams("var V"), withParams("field F")},
+		},
+		{
+			name:        "batches",
+			size:        2,
+			wantBatches: [][]string{{"type T", "var V"}, {"field F"}},
+			want:        []provider.Comment{withParams("type T"), {}, withParams("var V"), withParams("field F")},
+		},
+		{
+			name:        "failed batch",
+			size:        3,
+			fail:        true,
+			wantBatches: [][]string{{"type T", "var V", "field F"}},
+			want:        []provider.Comment{{}, {}, {}, {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeCommenter{size: tt.size, fail: tt.fail}
+			got, err := commentDecls(context.Background(), c, decls, 1)
+			if err != nil {
+				t.Fatalf("commentDecls() error = %v", err)
+			}
+			for i := range tt.want {
+				if got[i].Text() != tt.want[i].Text() {
+					t.Errorf("commentDecls()[%d] = %q, want %q", i, got[i].Text(), tt.want[i].Text())
+				}
+			}
+			if !reflect.DeepEqual(c.batches, tt.wantBatches) {
+				t.Errorf("batches = %q, want %q", c.batches, tt.wantBatches)
+			}
+		})
+	}
+}
+
+func TestOpenAIBatch(t *testing.T) {
+	want := []provider.Comment{
+		{Summary: "Foo does foo.", Params: []provider.ParamDoc{{Name: "x", Doc: "the input."}}},
+		{Summary: "Bar does bar.", Returns: []string{"the result."}},
+	}
+
+	var request openAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		answer, _ := json.Marshal(map[string]interface{}{"comments": want})
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{
+				map[string]interface{}{"message": map[string]interface{}{"content": string(answer)}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	apiKey := "key"
+	o := &openAI{
+		OpenAIConfig: OpenAIConfig{
+			APIKey:         &apiKey,
+			URL:            server.URL + "/v1",
+			Model:          "model",
+			ResponseFormat: responseFormatJSONSchema,
+			BatchSize:      10,
+		},
+		client: newHTTPClient("openai", server.URL, HTTPConfig{}),
+	}
+	if err := o.checkConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	decls := []provider.Decl{
+		{Kind: provider.KindFunc, Name: "Foo", Prompt: "Comment Foo."},
+		{Kind: provider.KindFunc, Name: "Bar", Prompt: "Comment Bar."},
+	}
+	got, err := o.Comment(context.Background(), decls)
+	if err != nil {
+		t.Fatalf("Comment() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Comment() = %+v, want %+v", got, want)
+	}
+
+	prompt := request.Messages[1].Content
+	if !strings.Contains(prompt, "Declaration 1:\nComment Foo.") || !strings.Contains(prompt, "Declaration 2:\nComment Bar.") {
+		t.Errorf("prompt = %q, want the two declarations", prompt)
+	}
+	if name := request.ResponseFormat["json_schema"].(map[string]interface{})["name"]; name != "doc_comments" {
+		t.Errorf("schema name = %v, want doc_comments", name)
+	}
+}
+
+func TestOpenAIBatchSizeConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		size    int
+		wantErr bool
+	}{
+		{name: "default", format: responseFormatText},
+		{name: "json", format: responseFormatJSON, size: 5},
+		{name: "text", format: responseFormatText, size: 5, wantErr: true},
+		{name: "negative", format: responseFormatJSON, size: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKey := "key"
+			o := &openAI{OpenAIConfig: OpenAIConfig{APIKey: &apiKey, ResponseFormat: tt.format, BatchSize: tt.size}}
+			if err := o.checkConfig(); (err != nil) != tt.wantErr {
+				t.Errorf("checkConfig() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseComment(t *testing.T) {
+	tests := []struct {
+		txt  string
+		want provider.Comment
+	}{
+		{txt: "", want: provider.Comment{}},
+		{txt: "// Foo does foo.\n", want: provider.Comment{Summary: "Foo does foo.", Details: []string{}}},
+		{
+			txt:  "// Foo does foo.\n// It takes x.\n//\n// Author: Bot.\n",
+			want: provider.Comment{Summary: "Foo does foo.", Details: []string{"It takes x.", "", "Author: Bot."}},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := parseComment(tt.txt); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseComment(%q) = %+v, want %+v", tt.txt, got, tt.want)
+		}
+	}
+}
+
+// funcProvider is a provider.Provider calling fn.
+type funcProvider struct {
+	name string
+	fn   func(decls []provider.Decl) ([]provider.Comment, error)
+}
+
+func (p funcProvider) Name() string { return p.name }
+
+func (p funcProvider) Comment(_ context.Context, decls []provider.Decl) ([]provider.Comment, error) {
+	return p.fn(decls)
+}
+
+// commentNames is a provider commenting the declarations with the given names.
+func commentNames(name string, names ...string) funcProvider {
+	return funcProvider{name: name, fn: func(decls []provider.Decl) ([]provider.Comment, error) {
+		comments := make([]provider.Comment, len(decls))
+		for i, decl := range decls {
+			for _, n := range names {
+				if decl.Name == n {
+					comments[i] = provider.Comment{Summary: decl.Name + " by " + name + "."}
+				}
+			}
+		}
+		return comments, nil
+	}}
+}
+
+func TestProviderChain(t *testing.T) {
+	failing := funcProvider{name: "failing", fn: func([]provider.Decl) ([]provider.Comment, error) {
+		return nil, errors.New("down")
+	}}
+	short := funcProvider{name: "short", fn: func([]provider.Decl) ([]provider.Comment, error) {
+		return []provider.Comment{{Summary: "Lost."}}, nil
+	}}
+
+	tests := []struct {
+		name          string
+		providers     []provider.Provider
+		want          []string
+		wantProducers []string
+	}{
+		{
+			name:          "first provider",
+			providers:     []provider.Provider{commentNames("a", "A", "B", "C"), commentNames("b", "A", "B", "C")},
+			want:          []string{"A by a.", "B by a.", "C by a."},
+			wantProducers: []string{"a", "a", "a"},
+		},
+		{
+			name:          "declarations left to the next provider",
+			providers:     []provider.Provider{commentNames("a", "B"), commentNames("b", "A", "B", "C")},
+			want:          []string{"A by b.", "B by a.", "C by b."},
+			wantProducers: []string{"b", "a", "b"},
+		},
+		{
+			name:          "failing providers skipped",
+			providers:     []provider.Provider{failing, short, commentNames("b", "A", "C")},
+			want:          []string{"A by b.", "", "C by b."},
+			wantProducers: []string{"b", "", "b"},
+		},
+	}
+
+	decls := []provider.Decl{{Name: "A"}, {Name: "B"}, {Name: "C"}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := &providerChain{providers: tt.providers}
+			comments, producers, err := chain.comment(context.Background(), decls)
+			if err != nil {
+				t.Fatalf("comment() error = %v", err)
+			}
+
+			got := make([]string, len(comments))
+			for i, comment := range comments {
+				got[i] = comment.Text()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("comment() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(producers, tt.wantProducers) {
+				t.Errorf("comment() producers = %q, want %q", producers, tt.wantProducers)
+			}
+		})
+	}
+}
+
+func TestProviderChainCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	chain := &providerChain{providers: []provider.Provider{
+		funcProvider{name: "canceled", fn: func([]provider.Decl) ([]provider.Comment, error) {
+			return nil, ctx.Err()
+		}},
+		commentNames("b", "A"),
+	}}
+	if _, _, err := chain.comment(ctx, []provider.Decl{{Name: "A"}}); !errors.Is(err, context.Canceled) {
+		t.Errorf("comment() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestNewProviderChain(t *testing.T) {
+	active := true
+
+	tests := []struct {
+		name    string
+		cfg     CommentConfig
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "no provider",
+			want: []string{"default"},
+		},
+		{
+			name: "active providers",
+			cfg: CommentConfig{
+				Ollama: OllamaConfig{Active: &active, Model: "llama3"},
+			},
+			want: []string{"ollama", "default"},
+		},
+		{
+			name: "listed providers",
+			cfg: CommentConfig{
+				Providers: []string{"ollama", "default", "openai"},
+				Ollama:    OllamaConfig{Model: "llama3"},
+			},
+			want: []string{"ollama", "default"},
+		},
+		{
+			name:    "unknown provider",
+			cfg:     CommentConfig{Providers: []string{"unknown"}},
+			wantErr: `unknown provider "unknown"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := newProviderChain(&tt.cfg, nil, Options{Jobs: 1})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newProviderChain() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newProviderChain() error = %v", err)
+			}
+
+			var got []string
+			for _, p := range chain.providers {
+				got = append(got, p.Name())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newProviderChain() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisteredProvider(t *testing.T) {
+	provider.Register(funcProvider{name: "test-registered", fn: func(decls []provider.Decl) ([]provider.Comment, error) {
+		comments := make([]provider.Comment, len(decls))
+		for i, decl := range decls {
+			comments[i] = provider.Comment{Summary: decl.Name + " is " + strings.ToLower(string(decl.Kind)) + "."}
+		}
+		return comments, nil
+	}})
+
+	dir := testModule(t, "providers: [test-registered]\n")
+	got := processTest(t, dir, "package a\n\nfunc Foo() {}\n\ntype T int\n")
+
+	want := "package a\n\n// Foo is func.\nfunc Foo() {}\n\n// T is type.\ntype T int\n"
+	if got != want {
+		t.Errorf("Process() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -2,41 +2,89 @@ package comments
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"go/ast"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
-	"time"
+
+	"github.com/ariden/gocomments/provider"
 )
 
 type LocalAIConfig struct {
-	Active          *bool  `yaml:"active"`
-	URL             string `yaml:"url"`
-	APIModelVersion int    `yaml:"api_model_version"`
+	Active          *bool      `yaml:"active"`
+	URL             string     `yaml:"url"`
+	APIModelVersion int        `yaml:"api_model_version"`
+	HTTP            HTTPConfig `yaml:"http"`
 }
 
 type localAI struct {
 	LocalAIConfig
+	defaultProcess
+	client *httpClient
 }
 
 func (o *localAI) isActive() bool {
-	if o.Active == nil || *o.Active == false {
-		return false
-	}
+	return o.Active != nil && *o.Active
+}
+
+func (o *localAI) checkConfig() error {
 	if o.URL == "" {
-		log.Fatal("please set the local API URL in the localai-url variable")
+		return errors.New("please set the local API URL in the localai-url variable")
 	}
 	if o.APIModelVersion == 0 {
 		o.APIModelVersion = 1
 	}
-	return true
+	return nil
+}
+
+// Name returns the name of the LocalAI provider.
+func (o *localAI) Name() string {
+	return "localai"
+}
+
+func (o *localAI) cacheModel() modelInfo {
+	return modelInfo{
+		Model:    "localai",
+		Version:  strconv.Itoa(o.APIModelVersion),
+		Settings: []string{o.URL},
+	}
+}
+
+// Comment generates the comments of the functions with the LocalAI model,
+// and the comments of the other declarations offline.
+func (o *localAI) Comment(ctx context.Context, decls []provider.Decl) ([]provider.Comment, error) {
+	return commentDecls(ctx, o, decls, o.jobs)
 }
 
-func (o *localAI) commentFunc(fn *ast.FuncDecl) (string, error) {
-	return o.callLocalAI(GenerateFuncCode(fn))
+func (o *localAI) commentFunc(ctx context.Context, decl provider.Decl) (string, error) {
+	return o.callLocalAI(ctx, decl.Signature)
+}
+
+// ping checks that the tokenizer API is up. A server still loading its
+// model answers with an error status, retried with the backoff policy.
+func (o *localAI) ping(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, o.URL+"/ping", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := o.client.do(ctx, req)
+	if err != nil {
+		return fmt.Errorf("fail to ping tokenizer API: %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fail to ping tokenizer API: %v", statusError(resp))
+	}
+	return nil
 }
 
 type TokenizeRequest struct {
@@ -48,7 +96,7 @@ type TokenizeResponse struct {
 	Comment string `json:"comment"`
 }
 
-func (o *localAI) callLocalAI(functionCode string) (string, error) {
+func (o *localAI) callLocalAI(ctx context.Context, functionCode string) (string, error) {
 	requestBody, err := json.Marshal(TokenizeRequest{
 		Text:    functionCode,
 		Version: o.APIModelVersion,
@@ -57,23 +105,20 @@ func (o *localAI) callLocalAI(functionCode string) (string, error) {
 		return "", err
 	}
 
-	for {
-		resp, err := http.Get(o.URL + "/ping")
-		if err != nil {
-			log.Printf("fail to ping tokenizer API: %+v", err)
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		if resp.StatusCode == http.StatusOK {
-			break
-		}
-		time.Sleep(10 * time.Second)
+	if err := o.ping(ctx); err != nil {
+		return "", err
 	}
 
-	resp, err := http.Post(o.URL+"/tokenize", "application/json", bytes.NewBuffer(requestBody))
+	req, err := http.NewRequest(http.MethodPost, o.URL+"/tokenize", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return "", err
 	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.do(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("fail to call tokenizer API: %v", err)
+	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
 			log.Printf("fail to close reponse: %+v", err)
@@ -118,28 +163,3 @@ func addDoubleSlash(input string) string {
 	// Join the modified lines back together with newlines.
 	return strings.Join(lines, "\n")
 }
-
-func (o *localAI) commentConst(name string, exported bool) (string, error) {
-	var exportedTxt string
-	if !exported {
-		exportedTxt = "private "
-	}
-	explainConst := convertVarToCamelCaseTo(name)
-	txt := fmt.Sprintf("// %s is a %sconstant%s.", name, exportedTxt, explainConst)
-
-	return txt, nil
-}
-
-func (o *localAI) commentVar(name, declType, explainVar string, exported bool) (string, error) {
-	var exportedTxt string
-	if !exported {
-		exportedTxt = "private "
-	}
-	txt := fmt.Sprintf("// %s is a %svariable of type %s%s.", name, exportedTxt, declType, explainVar)
-
-	return txt, nil
-}
-
-func (o *localAI) commentType(_ *ast.GenDecl) (string, error) {
-	return "", nil
-}
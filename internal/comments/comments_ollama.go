@@ -0,0 +1,317 @@
+package comments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ariden/gocomments/provider"
+)
+
+// The defaults of the Ollama provider.
+const (
+	defaultOllamaURL = "http://localhost:11434"
+	ollamaAPIGen     = "generate"
+	ollamaAPIChat    = "chat"
+)
+
+type OllamaConfig struct {
+	// Do we use Ollama to generate function comments
+	Active *bool `yaml:"active"`
+	// URL is the base URL of the Ollama server, http://localhost:11434 by
+	// default.
+	URL string `yaml:"url"`
+	// Model is the name of the model, like "qwen2.5-coder:7b".
+	Model string `yaml:"model"`
+	// API is the API called, "generate" by default or "chat".
+	API string `yaml:"api"`
+	// System is the system prompt of the requests.
+	System      string   `yaml:"system"`
+	Temperature *float64 `yaml:"temperature"`
+	// MaxTokens is the maximum number of tokens generated, the num_predict
+	// option of Ollama. The model default is used when it is not set.
+	MaxTokens int `yaml:"max-tokens"`
+	// CheckModel checks at startup with /api/tags that the model is pulled
+	// on the server.
+	CheckModel *bool      `yaml:"check-model"`
+	HTTP       HTTPConfig `yaml:"http"`
+}
+
+// Merge returns the configuration overridden by the values set in newCfg.
+func (cfg OllamaConfig) Merge(newCfg OllamaConfig) OllamaConfig {
+	if newCfg.Active != nil {
+		cfg.Active = newCfg.Active
+	}
+	if newCfg.URL != "" {
+		cfg.URL = newCfg.URL
+	}
+	if newCfg.Model != "" {
+		cfg.Model = newCfg.Model
+	}
+	if newCfg.API != "" {
+		cfg.API = newCfg.API
+	}
+	if newCfg.System != "" {
+		cfg.System = newCfg.System
+	}
+	if newCfg.Temperature != nil {
+		cfg.Temperature = newCfg.Temperature
+	}
+	if newCfg.MaxTokens != 0 {
+		cfg.MaxTokens = newCfg.MaxTokens
+	}
+	if newCfg.CheckModel != nil {
+		cfg.CheckModel = newCfg.CheckModel
+	}
+	cfg.HTTP = cfg.HTTP.Merge(newCfg.HTTP)
+	return cfg
+}
+
+type ollama struct {
+	OllamaConfig
+	defaultProcess
+	client *httpClient
+}
+
+func (o *ollama) isActive() bool {
+	return o.Active != nil && *o.Active
+}
+
+func (o *ollama) checkConfig() error {
+	if o.URL == "" {
+		o.URL = defaultOllamaURL
+	}
+	if o.System == "" {
+		o.System = defaultSystemPrompt
+	}
+	if o.Model == "" {
+		return errors.New("please set the name of the model in the ollama-model variable")
+	}
+
+	switch o.API {
+	case "":
+		o.API = ollamaAPIGen
+	case ollamaAPIGen, ollamaAPIChat:
+	default:
+		return fmt.Errorf("unknown API %q in the ollama-api variable, expecting %s or %s", o.API, ollamaAPIGen, ollamaAPIChat)
+	}
+
+	if o.CheckModel != nil && *o.CheckModel {
+		return o.checkModel(context.Background())
+	}
+	return nil
+}
+
+// Name returns the name of the Ollama provider.
+func (o *ollama) Name() string {
+	return "ollama"
+}
+
+func (o *ollama) cacheModel() modelInfo {
+	return modelInfo{
+		Model:    withLatestTag(o.Model),
+		Settings: []string{o.API, o.System, formatFloat(o.Temperature), strconv.Itoa(o.MaxTokens)},
+	}
+}
+
+// Comment generates the comments of the functions with the Ollama model,
+// and the comments of the other declarations offline.
+func (o *ollama) Comment(ctx context.Context, decls []provider.Decl) ([]provider.Comment, error) {
+	return commentDecls(ctx, o, decls, o.jobs)
+}
+
+func (o *ollama) commentPrompt(ctx context.Context, prompt string) (provider.Comment, error) {
+	txt, err := o.callOllama(ctx, prompt)
+	if err != nil {
+		return provider.Comment{}, err
+	}
+	return parseComment(txt), nil
+}
+
+var (
+	ollamaModelsMu sync.Mutex
+	// ollamaModels are the models found on each server, keyed by the server
+	// URL and the model name, so that /api/tags is called once per model
+	// rather than for each file.
+	ollamaModels = make(map[string]error)
+)
+
+// checkModel checks that the model is pulled on the Ollama server.
+func (o *ollama) checkModel(ctx context.Context) error {
+	ollamaModelsMu.Lock()
+	defer ollamaModelsMu.Unlock()
+
+	key := o.URL + " " + o.Model
+	if err, ok := ollamaModels[key]; ok {
+		return err
+	}
+
+	err := o.findModel(ctx)
+	ollamaModels[key] = err
+	return err
+}
+
+// ollamaTagsResponse is the body of a /api/tags response.
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// findModel looks for the model in the list of the models of the server. A
+// name without tag stands for the "latest" tag, like with the ollama command.
+func (o *ollama) findModel(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(o.URL, "/")+"/api/tags", nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+
+	resp, err := o.client.do(ctx, req)
+	if err != nil {
+		return fmt.Errorf("fail to list the models of the Ollama server at %s: %v", o.URL, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fail to list the models of the Ollama server at %s: %v", o.URL, statusError(resp))
+	}
+
+	var tags ollamaTagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return fmt.Errorf("error decoding the models of the Ollama server: %v", err)
+	}
+
+	model := withLatestTag(o.Model)
+	for _, m := range tags.Models {
+		if withLatestTag(m.Name) == model {
+			return nil
+		}
+	}
+	return fmt.Errorf("model %q not found on the Ollama server at %s, pull it with \"ollama pull %s\"", o.Model, o.URL, o.Model)
+}
+
+// withLatestTag returns the name of a model with the "latest" tag when it has
+// no tag.
+func withLatestTag(model string) string {
+	if strings.Contains(model, ":") {
+		return model
+	}
+	return model + ":latest"
+}
+
+// ollamaOptions are the model parameters of a request.
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+}
+
+// ollamaMessage is a message of the chat API.
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ollamaRequest is the body of a request to the generate API, with a prompt,
+// or to the chat API, with messages.
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Prompt   string          `json:"prompt,omitempty"`
+	System   string          `json:"system,omitempty"`
+	Messages []ollamaMessage `json:"messages,omitempty"`
+	Stream   bool            `json:"stream"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+}
+
+// ollamaResponse is the body of a response of the generate API, with a
+// response, or of the chat API, with a message.
+type ollamaResponse struct {
+	Response string         `json:"response"`
+	Message  *ollamaMessage `json:"message"`
+	Error    string         `json:"error"`
+}
+
+// callOllama sends prompt to the Ollama server and returns the text of the
+// answer.
+func (o *ollama) callOllama(ctx context.Context, prompt string) (string, error) {
+	payload := ollamaRequest{
+		Model:  o.Model,
+		Stream: false,
+	}
+	if o.Temperature != nil || o.MaxTokens != 0 {
+		payload.Options = &ollamaOptions{
+			Temperature: o.Temperature,
+			NumPredict:  o.MaxTokens,
+		}
+	}
+	if o.API == ollamaAPIChat {
+		payload.Messages = []ollamaMessage{
+			{Role: "system", Content: o.System},
+			{Role: "user", Content: prompt},
+		}
+	} else {
+		payload.Prompt = prompt
+		payload.System = o.System
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling payload: %v", err)
+	}
+
+	endpoint := strings.TrimSuffix(o.URL, "/") + "/api/" + o.API
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.do(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("error making request: %v", err)
+	}
+	defer func(Body io.ReadCloser) {
+		if err := Body.Close(); err != nil {
+			log.Println("fail to close reader")
+		}
+	}(resp.Body)
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response body: %v", err)
+	}
+
+	var response ollamaResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("request failed with status %d: %s", resp.StatusCode, respBody)
+		}
+		return "", fmt.Errorf("error unmarshalling response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if response.Error != "" {
+			return "", fmt.Errorf("request failed with status %d: %s", resp.StatusCode, response.Error)
+		}
+		return "", fmt.Errorf("request failed with status %d: %s", resp.StatusCode, respBody)
+	}
+
+	text := response.Response
+	if response.Message != nil {
+		text = response.Message.Content
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", errors.New("no text in the response")
+	}
+
+	return cleanComment(text), nil
+}
@@ -0,0 +1,178 @@
+package comments
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOllamaRequest(t *testing.T) {
+	temperature := 0.2
+
+	tests := []struct {
+		name     string
+		cfg      OllamaConfig
+		status   int
+		answer   map[string]interface{}
+		wantPath string
+		wantBody ollamaRequest
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "generate",
+			cfg:      OllamaConfig{Model: "qwen", Temperature: &temperature, MaxTokens: 100},
+			answer:   map[string]interface{}{"response": "// Foo does foo."},
+			wantPath: "/api/generate",
+			wantBody: ollamaRequest{
+				Model:   "qwen",
+				Prompt:  "Comment Foo.",
+				System:  defaultSystemPrompt,
+				Options: &ollamaOptions{Temperature: &temperature, NumPredict: 100},
+			},
+			want: "Foo does foo.",
+		},
+		{
+			name:     "chat",
+			cfg:      OllamaConfig{Model: "qwen", API: ollamaAPIChat, System: "Be brief."},
+			answer:   map[string]interface{}{"message": map[string]string{"role": "assistant", "content": "Foo does foo."}},
+			wantPath: "/api/chat",
+			wantBody: ollamaRequest{
+				Model: "qwen",
+				Messages: []ollamaMessage{
+					{Role: "system", Content: "Be brief."},
+					{Role: "user", Content: "Comment Foo."},
+				},
+			},
+			want: "Foo does foo.",
+		},
+		{
+			name:     "error",
+			cfg:      OllamaConfig{Model: "qwen"},
+			status:   http.StatusNotFound,
+			answer:   map[string]interface{}{"error": "model 'qwen' not found"},
+			wantPath: "/api/generate",
+			wantBody: ollamaRequest{Model: "qwen", Prompt: "Comment Foo.", System: defaultSystemPrompt},
+			wantErr:  "request failed with status 404: model 'qwen' not found",
+		},
+		{
+			name:     "empty answer",
+			cfg:      OllamaConfig{Model: "qwen"},
+			answer:   map[string]interface{}{"response": " "},
+			wantPath: "/api/generate",
+			wantBody: ollamaRequest{Model: "qwen", Prompt: "Comment Foo.", System: defaultSystemPrompt},
+			wantErr:  "no text in the response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				path string
+				body ollamaRequest
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				data, _ := io.ReadAll(r.Body)
+				if err := json.Unmarshal(data, &body); err != nil {
+					t.Errorf("invalid request body %s: %v", data, err)
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				_ = json.NewEncoder(w).Encode(tt.answer)
+			}))
+			defer server.Close()
+
+			o := &ollama{OllamaConfig: tt.cfg, client: newHTTPClient("ollama", server.URL, HTTPConfig{})}
+			o.URL = server.URL + "/"
+			if err := o.checkConfig(); err != nil {
+				t.Fatal(err)
+			}
+
+			comment, err := o.commentPrompt(context.Background(), "Comment Foo.")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("commentPrompt() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("commentPrompt() error = %v", err)
+			} else if got := comment.Text(); got != tt.want {
+				t.Errorf("commentPrompt() = %q, want %q", got, tt.want)
+			}
+
+			if path != tt.wantPath {
+				t.Errorf("path = %q, want %q", path, tt.wantPath)
+			}
+			if !reflect.DeepEqual(body, tt.wantBody) {
+				t.Errorf("body = %+v, want %+v", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestOllamaCheckModel(t *testing.T) {
+	tests := []struct {
+		model   string
+		wantErr bool
+	}{
+		{model: "llama3"},
+		{model: "llama3:latest"},
+		{model: "qwen2.5-coder:7b"},
+		{model: "qwen2.5-coder", wantErr: true},
+		{model: "mistral", wantErr: true},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, `{"models":[{"name":"llama3:latest"},{"name":"qwen2.5-coder:7b"}]}`)
+	}))
+	defer server.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			check := true
+			o := &ollama{
+				OllamaConfig: OllamaConfig{URL: server.URL, Model: tt.model, CheckModel: &check},
+				client:       newHTTPClient("ollama", server.URL, HTTPConfig{}),
+			}
+			if err := o.checkConfig(); (err != nil) != tt.wantErr {
+				t.Errorf("checkConfig() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOllamaConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     OllamaConfig
+		wantErr bool
+	}{
+		{name: "defaults", cfg: OllamaConfig{Model: "llama3"}},
+		{name: "chat", cfg: OllamaConfig{Model: "llama3", API: ollamaAPIChat}},
+		{name: "no model", wantErr: true},
+		{name: "unknown API", cfg: OllamaConfig{Model: "llama3", API: "completions"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &ollama{OllamaConfig: tt.cfg}
+			err := o.checkConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkConfig() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (o.URL != defaultOllamaURL || o.API == "") {
+				t.Errorf("checkConfig() URL %q and API %q, want the defaults", o.URL, o.API)
+			}
+		})
+	}
+}
@@ -2,43 +2,358 @@ package comments
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"go/ast"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 
-	"moul.io/http2curl"
+	"github.com/ariden/gocomments/provider"
 )
 
+// The defaults of the OpenAI provider.
+const (
+	defaultOpenAIURL        = "https://api.openai.com/v1"
+	openAIHost              = "api.openai.com"
+	defaultOpenAIModel      = "gpt-4o-mini"
+	defaultOpenAIMaxTokens  = 300
+	defaultAzureAPIVersion  = "2024-10-21"
+	chatCompletionsEndpoint = "/chat/completions"
+)
+
+// The response formats of the OpenAI provider.
+const (
+	// responseFormatText asks for the raw text of the comment.
+	responseFormatText = "text"
+	// responseFormatJSON asks for a JSON object with the JSON mode.
+	responseFormatJSON = "json"
+	// responseFormatJSONSchema asks for a JSON object following
+	// commentSchema with the structured outputs.
+	responseFormatJSONSchema = "json-schema"
+)
+
+// commentFieldsPrompt describes the fields of the JSON object of a comment.
+const commentFieldsPrompt = "the fields \"summary\", the first sentence " +
+	"of the comment starting with the name of the declaration, \"details\", the following lines, " +
+	"\"params\", the list of the parameters with their \"name\" and \"doc\", and \"returns\", " +
+	"the descriptions of the return values."
+
+// jsonCommentPrompt describes the JSON object of the comment expected in the
+// JSON response formats.
+const jsonCommentPrompt = "Answer with a JSON object with " + commentFieldsPrompt
+
+// jsonBatchPrompt describes the JSON object of the comments of a batch of
+// declarations.
+const jsonBatchPrompt = "Answer with a JSON object with the field \"comments\", the list of the comments " +
+	"of the declarations in the same order, each one being an object with " + commentFieldsPrompt
+
+// commentSchema is the JSON schema of provider.Comment used by the structured
+// outputs. Strict schemas require all the properties.
+var commentSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"summary": map[string]interface{}{"type": "string"},
+		"details": map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{"type": "string"},
+		},
+		"params": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"type": "string"},
+					"doc":  map[string]interface{}{"type": "string"},
+				},
+				"required":             []string{"name", "doc"},
+				"additionalProperties": false,
+			},
+		},
+		"returns": map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{"type": "string"},
+		},
+	},
+	"required":             []string{"summary", "details", "params", "returns"},
+	"additionalProperties": false,
+}
+
+// batchSchema is the JSON schema of the comments of a batch of declarations.
+var batchSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"comments": map[string]interface{}{
+			"type":  "array",
+			"items": commentSchema,
+		},
+	},
+	"required":             []string{"comments"},
+	"additionalProperties": false,
+}
+
 type OpenAIConfig struct {
 	// Do we use OPENAI to generate function comments
-	Active *bool   `yaml:"active"`
+	Active *bool `yaml:"active"`
+	// APIKey is the key of the API. The OPENAI_API_KEY environment variable,
+	// or AZURE_OPENAI_API_KEY for Azure, is used when it is not set. It is
+	// optional for the other OpenAI-compatible servers.
 	APIKey *string `yaml:"api_key"`
-	URL    string  `yaml:"url"`
+	// URL is the base URL of the API, https://api.openai.com/v1 by default,
+	// like http://localhost:8000/v1 for vLLM, http://localhost:8080/v1 for
+	// the llama.cpp server or http://localhost:1234/v1 for LM Studio. The
+	// URL of the chat completions endpoint is accepted too. For Azure, it is
+	// the endpoint of the resource, like https://<resource>.openai.azure.com.
+	URL string `yaml:"url"`
+	// Model is the name of the model, required for the servers other than
+	// OpenAI and Azure.
+	Model       string   `yaml:"model"`
+	Temperature *float64 `yaml:"temperature"`
+	MaxTokens   int      `yaml:"max-tokens"`
+	// Organization is sent in the OpenAI-Organization header.
+	Organization string `yaml:"organization"`
+	// System is the system prompt of the requests.
+	System string `yaml:"system"`
+	// ResponseFormat is "text" by default, "json" for the JSON mode or
+	// "json-schema" for the structured outputs, which also describe the
+	// parameters and the return values.
+	ResponseFormat string `yaml:"response-format"`
+	// BatchSize is the largest number of declarations commented in a single
+	// request, 1 by default. It requires a JSON response format.
+	BatchSize int `yaml:"batch-size"`
+	// AzureDeployment calls the model deployed under this name on Azure
+	// OpenAI, authenticated with the api-key header.
+	AzureDeployment string     `yaml:"azure-deployment"`
+	APIVersion      string     `yaml:"api-version"`
+	HTTP            HTTPConfig `yaml:"http"`
+}
+
+// Merge returns the configuration overridden by the values set in newCfg.
+func (cfg OpenAIConfig) Merge(newCfg OpenAIConfig) OpenAIConfig {
+	if newCfg.Active != nil {
+		cfg.Active = newCfg.Active
+	}
+	if newCfg.APIKey != nil {
+		cfg.APIKey = newCfg.APIKey
+	}
+	if newCfg.URL != "" {
+		cfg.URL = newCfg.URL
+	}
+	if newCfg.Model != "" {
+		cfg.Model = newCfg.Model
+	}
+	if newCfg.Temperature != nil {
+		cfg.Temperature = newCfg.Temperature
+	}
+	if newCfg.MaxTokens != 0 {
+		cfg.MaxTokens = newCfg.MaxTokens
+	}
+	if newCfg.Organization != "" {
+		cfg.Organization = newCfg.Organization
+	}
+	if newCfg.System != "" {
+		cfg.System = newCfg.System
+	}
+	if newCfg.ResponseFormat != "" {
+		cfg.ResponseFormat = newCfg.ResponseFormat
+	}
+	if newCfg.BatchSize != 0 {
+		cfg.BatchSize = newCfg.BatchSize
+	}
+	if newCfg.AzureDeployment != "" {
+		cfg.AzureDeployment = newCfg.AzureDeployment
+	}
+	if newCfg.APIVersion != "" {
+		cfg.APIVersion = newCfg.APIVersion
+	}
+	cfg.HTTP = cfg.HTTP.Merge(newCfg.HTTP)
+	return cfg
 }
 
 type openAI struct {
 	OpenAIConfig
+	defaultProcess
+	client *httpClient
 }
 
 func (o *openAI) isActive() bool {
-	if o.Active == nil || *o.Active == false {
-		return false
+	return o.Active != nil && *o.Active
+}
+
+func (o *openAI) isAzure() bool {
+	return o.AzureDeployment != ""
+}
+
+// isOpenAI tells whether the provider calls the OpenAI API itself, rather
+// than a compatible server, from the host of its URL.
+func (o *openAI) isOpenAI() bool {
+	u, err := url.Parse(o.URL)
+	return err == nil && strings.EqualFold(u.Hostname(), openAIHost)
+}
+
+func (o *openAI) checkConfig() error {
+	if o.URL == "" && !o.isAzure() {
+		o.URL = defaultOpenAIURL
+	}
+	if o.URL != "" {
+		u, err := url.Parse(o.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid URL %q in the openai-url variable", o.URL)
+		}
+		// The URL of the chat completions endpoint gives its base URL.
+		o.URL = strings.TrimSuffix(strings.TrimSuffix(o.URL, "/"), chatCompletionsEndpoint)
+	}
+	if o.MaxTokens == 0 {
+		o.MaxTokens = defaultOpenAIMaxTokens
+	}
+	if o.System == "" {
+		o.System = defaultSystemPrompt
+	}
+
+	switch o.ResponseFormat {
+	case "":
+		o.ResponseFormat = responseFormatText
+	case responseFormatText, responseFormatJSON, responseFormatJSONSchema:
+	default:
+		return fmt.Errorf("unknown response format %q in the openai-response-format variable, expecting %s, %s or %s",
+			o.ResponseFormat, responseFormatText, responseFormatJSON, responseFormatJSONSchema)
 	}
+
+	switch {
+	case o.BatchSize < 0:
+		return fmt.Errorf("invalid batch size %d in the openai-batch-size variable", o.BatchSize)
+	case o.BatchSize > 1 && o.ResponseFormat == responseFormatText:
+		return fmt.Errorf("the openai-batch-size variable requires the %s or %s response format", responseFormatJSON, responseFormatJSONSchema)
+	}
+
 	if o.APIKey == nil || *o.APIKey == "" {
-		log.Fatal("Please set your OpenAI API key in the openai-api_key variable.")
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if o.isAzure() {
+			apiKey = os.Getenv("AZURE_OPENAI_API_KEY")
+		}
+		o.APIKey = &apiKey
+	}
+
+	switch {
+	case o.isAzure():
+		if o.URL == "" {
+			return errors.New("please set the endpoint of your Azure OpenAI resource in the openai-url variable")
+		}
+		if *o.APIKey == "" {
+			return errors.New("please set your Azure OpenAI API key in the openai-api_key variable or in AZURE_OPENAI_API_KEY")
+		}
+		if o.APIVersion == "" {
+			o.APIVersion = defaultAzureAPIVersion
+		}
+	case o.isOpenAI():
+		if *o.APIKey == "" {
+			return errors.New("please set your OpenAI API key in the openai-api_key variable or in OPENAI_API_KEY")
+		}
+		if o.Model == "" {
+			o.Model = defaultOpenAIModel
+		}
+	default:
+		if o.Model == "" {
+			return fmt.Errorf("please set the model served by %s in the openai-model variable", o.URL)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the OpenAI provider.
+func (o *openAI) Name() string {
+	return "openai"
+}
+
+func (o *openAI) cacheModel() modelInfo {
+	info := modelInfo{
+		Model:    o.Model,
+		Settings: []string{o.URL, o.System, o.ResponseFormat, formatFloat(o.Temperature), strconv.Itoa(o.MaxTokens), strconv.Itoa(o.BatchSize)},
+	}
+	if o.isAzure() {
+		info.Model, info.Version = o.AzureDeployment, o.APIVersion
+	}
+	return info
+}
+
+// Comment generates the comments of the functions with the OpenAI model,
+// and the comments of the other declarations offline. With a batch size, the
+// declarations are sent to the model in batches.
+func (o *openAI) Comment(ctx context.Context, decls []provider.Decl) ([]provider.Comment, error) {
+	return commentDecls(ctx, o, decls, o.jobs)
+}
+
+func (o *openAI) commentPrompt(ctx context.Context, prompt string) (provider.Comment, error) {
+	if o.ResponseFormat == responseFormatText {
+		txt, err := o.callOpenAI(ctx, prompt, nil)
+		if err != nil {
+			return provider.Comment{}, err
+		}
+		return parseComment(txt), nil
 	}
-	if o.URL == "" {
-		log.Fatal("Please set the OpenAI API URL in the openai-url variable.")
+
+	var comment provider.Comment
+	if err := o.callOpenAIJSON(ctx, prompt+"\n\n"+jsonCommentPrompt, "doc_comment", commentSchema, &comment); err != nil {
+		return provider.Comment{}, err
 	}
-	return true
+	return comment, nil
 }
 
-func (o *openAI) commentFunc(fn *ast.FuncDecl) (string, error) {
-	return o.callOpenAI(GenerateFuncCode(fn))
+func (o *openAI) batchSize() int {
+	return o.BatchSize
+}
+
+// commentPrompts sends the prompts in a single request, and returns the
+// comments of the JSON answer.
+func (o *openAI) commentPrompts(ctx context.Context, prompts []string) ([]provider.Comment, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Write the doc comments of the %d following declarations.\n", len(prompts))
+	for i, prompt := range prompts {
+		fmt.Fprintf(&b, "\nDeclaration %d:\n%s\n", i+1, prompt)
+	}
+	b.WriteString("\n" + jsonBatchPrompt)
+
+	var batch struct {
+		Comments []provider.Comment `json:"comments"`
+	}
+	if err := o.callOpenAIJSON(ctx, b.String(), "doc_comments", batchSchema, &batch); err != nil {
+		return nil, err
+	}
+	if len(batch.Comments) != len(prompts) {
+		return nil, fmt.Errorf("%d comments returned for %d declarations", len(batch.Comments), len(prompts))
+	}
+	return batch.Comments, nil
+}
+
+// callOpenAIJSON sends prompt to the chat completions API with the JSON
+// response format, or the structured outputs following schema, and decodes
+// the JSON answer into v.
+func (o *openAI) callOpenAIJSON(ctx context.Context, prompt, name string, schema map[string]interface{}, v interface{}) error {
+	format := map[string]interface{}{"type": "json_object"}
+	if o.ResponseFormat == responseFormatJSONSchema {
+		format = map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   name,
+				"strict": true,
+				"schema": schema,
+			},
+		}
+	}
+
+	answer, err := o.callOpenAI(ctx, prompt, format)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(answer), v); err != nil {
+		return fmt.Errorf("error unmarshalling the JSON comment: %v", err)
+	}
+	return nil
 }
 
 type OpenAIMessage struct {
@@ -46,79 +361,123 @@ type OpenAIMessage struct {
 	Content string `json:"content"`
 }
 
-func (o *openAI) callOpenAI(functionCode string) (string, error) {
-	prompt := fmt.Sprintf("Generate a detailed comment in English for the following Go function. The comment should be written in a way that is helpful for other developers. Include the purpose of the function, a description of its parameters and return values, potential error conditions, and any side effects or important details. Here is the function :\n%s", functionCode)
+// openAIRequest is the body of a chat completions request. OpenAI and Azure
+// expect max_completion_tokens, the compatible servers max_tokens.
+type openAIRequest struct {
+	Model               string                 `json:"model,omitempty"`
+	Messages            []OpenAIMessage        `json:"messages"`
+	Temperature         *float64               `json:"temperature,omitempty"`
+	MaxTokens           int                    `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                    `json:"max_completion_tokens,omitempty"`
+	ResponseFormat      map[string]interface{} `json:"response_format,omitempty"`
+}
+
+// openAIResponse is the body of a chat completions response.
+type openAIResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+			Refusal string `json:"refusal"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// endpoint returns the URL of the chat completions, from the base URL set by
+// checkConfig.
+func (o *openAI) endpoint() string {
+	if o.isAzure() {
+		return o.URL + "/openai/deployments/" + url.PathEscape(o.AzureDeployment) +
+			chatCompletionsEndpoint + "?api-version=" + url.QueryEscape(o.APIVersion)
+	}
+	return o.URL + chatCompletionsEndpoint
+}
 
-	requestBody, err := json.Marshal(map[string]interface{}{
-		"max_tokens":  150,
-		"temperature": 0.7,
-		"model":       "gpt-3.5-turbo",
-		"messages": []OpenAIMessage{
-			{Role: "system", Content: "You are a helpful assistant."},
+// callOpenAI sends prompt to the chat completions API with the given response
+// format, nil for the text, and returns the answer.
+func (o *openAI) callOpenAI(ctx context.Context, prompt string, format map[string]interface{}) (string, error) {
+	payload := openAIRequest{
+		Messages: []OpenAIMessage{
+			{Role: "system", Content: o.System},
 			{Role: "user", Content: prompt},
 		},
-	})
+		Temperature:    o.Temperature,
+		ResponseFormat: format,
+	}
+	if !o.isAzure() {
+		payload.Model = o.Model
+	}
+	if o.isAzure() || o.isOpenAI() {
+		payload.MaxCompletionTokens = o.MaxTokens
+	} else {
+		payload.MaxTokens = o.MaxTokens
+	}
 
+	body, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("error creating request body: %v", err)
+		return "", fmt.Errorf("error marshalling payload: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", o.URL, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequest(http.MethodPost, o.endpoint(), bytes.NewBuffer(body))
 	if err != nil {
 		return "", fmt.Errorf("error creating request: %v", err)
 	}
-
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+*o.APIKey)
 
-	client := &http.Client{}
-
-	command, _ := http2curl.GetCurlCommand(req)
-	fmt.Println(fmt.Sprintf("%s", command))
+	switch {
+	case o.isAzure():
+		req.Header.Set("api-key", *o.APIKey)
+	case *o.APIKey != "":
+		req.Header.Set("Authorization", "Bearer "+*o.APIKey)
+	}
+	if o.Organization != "" && !o.isAzure() {
+		req.Header.Set("OpenAI-Organization", o.Organization)
+	}
 
-	resp, err := client.Do(req)
+	resp, err := o.client.do(ctx, req)
 	if err != nil {
 		return "", fmt.Errorf("error making request: %v", err)
 	}
 	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-
+		if err := Body.Close(); err != nil {
+			log.Println("fail to close reader")
 		}
 	}(resp.Body)
 
-	var response map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("error decoding response: %v", err)
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response body: %v", err)
 	}
 
-	if choices, ok := response["choices"].([]interface{}); ok && len(choices) > 0 {
-		if choice, ok := choices[0].(map[string]interface{}); ok {
-			if text, ok := choice["text"].(string); ok {
-				return text, nil
-
-			} else {
-				return "", errors.New("error: no text found in response choice")
-			}
-		} else {
-			return "", errors.New("error: invalid choice format")
+	var response openAIResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("request failed with status %d: %s", resp.StatusCode, respBody)
 		}
+		return "", fmt.Errorf("error unmarshalling response: %v", err)
 	}
 
-	return "", errors.New("error: no choices found in response")
-}
-
-func (o *openAI) commentConst(string, bool) (string, error) {
-	var constComment string
-	return constComment, nil
-}
+	if resp.StatusCode != http.StatusOK {
+		if response.Error != nil {
+			return "", fmt.Errorf("request failed with status %d: %s: %s", resp.StatusCode, response.Error.Type, response.Error.Message)
+		}
+		return "", fmt.Errorf("request failed with status %d: %s", resp.StatusCode, respBody)
+	}
 
-func (o *openAI) commentVar(name, declType, explainVar string, exported bool) (string, error) {
-	var varComment string
-	return varComment, nil
-}
+	if len(response.Choices) == 0 {
+		return "", errors.New("no choices found in the response")
+	}
+	choice := response.Choices[0]
+	if choice.Message.Refusal != "" {
+		return "", fmt.Errorf("the model refused to answer: %s", choice.Message.Refusal)
+	}
+	if strings.TrimSpace(choice.Message.Content) == "" {
+		return "", fmt.Errorf("no content in the response, finish reason %q", choice.FinishReason)
+	}
 
-func (o *openAI) commentType(genDecl *ast.GenDecl) (string, error) {
-	var typeComment string
-	return typeComment, nil
+	return cleanComment(choice.Message.Content), nil
 }
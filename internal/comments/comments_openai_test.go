@@ -0,0 +1,184 @@
+package comments
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          OpenAIConfig
+		wantOpenAI   bool
+		wantEndpoint string
+		wantModel    string
+		wantErr      bool
+	}{
+		{
+			name:         "default",
+			wantOpenAI:   true,
+			wantEndpoint: "https://api.openai.com/v1/chat/completions",
+			wantModel:    defaultOpenAIModel,
+		},
+		{
+			name:         "chat completions URL",
+			cfg:          OpenAIConfig{URL: "https://api.openai.com/v1/chat/completions"},
+			wantOpenAI:   true,
+			wantEndpoint: "https://api.openai.com/v1/chat/completions",
+			wantModel:    defaultOpenAIModel,
+		},
+		{
+			name:         "trailing slash",
+			cfg:          OpenAIConfig{URL: "https://API.openai.com/v1/"},
+			wantOpenAI:   true,
+			wantEndpoint: "https://API.openai.com/v1/chat/completions",
+			wantModel:    defaultOpenAIModel,
+		},
+		{
+			name:         "compatible server",
+			cfg:          OpenAIConfig{URL: "http://localhost:8000/v1/chat/completions", Model: "qwen"},
+			wantEndpoint: "http://localhost:8000/v1/chat/completions",
+			wantModel:    "qwen",
+		},
+		{
+			name:    "compatible server without model",
+			cfg:     OpenAIConfig{URL: "http://localhost:8000/v1"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid URL",
+			cfg:     OpenAIConfig{URL: "localhost:8000/v1"},
+			wantErr: true,
+		},
+		{
+			name:         "azure",
+			cfg:          OpenAIConfig{URL: "https://res.openai.azure.com/", AzureDeployment: "gpt 4o"},
+			wantEndpoint: "https://res.openai.azure.com/openai/deployments/gpt%204o/chat/completions?api-version=" + defaultAzureAPIVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKey := "key"
+			o := &openAI{OpenAIConfig: tt.cfg}
+			o.APIKey = &apiKey
+
+			err := o.checkConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkConfig() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := o.isOpenAI(); got != tt.wantOpenAI {
+				t.Errorf("isOpenAI() = %v, want %v", got, tt.wantOpenAI)
+			}
+			if got := o.endpoint(); got != tt.wantEndpoint {
+				t.Errorf("endpoint() = %q, want %q", got, tt.wantEndpoint)
+			}
+			if o.Model != tt.wantModel {
+				t.Errorf("model = %q, want %q", o.Model, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestOpenAIRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        OpenAIConfig
+		apiKey     string
+		wantPath   string
+		wantHeader map[string]string
+		wantModel  string
+	}{
+		{
+			name:       "compatible server",
+			cfg:        OpenAIConfig{Model: "qwen", MaxTokens: 100, Organization: "org"},
+			apiKey:     "sk-test",
+			wantPath:   "/v1/chat/completions",
+			wantHeader: map[string]string{"Authorization": "Bearer sk-test", "OpenAI-Organization": "org", "Api-Key": ""},
+			wantModel:  "qwen",
+		},
+		{
+			name:       "compatible server without key",
+			cfg:        OpenAIConfig{Model: "qwen", MaxTokens: 100},
+			wantPath:   "/v1/chat/completions",
+			wantHeader: map[string]string{"Authorization": ""},
+			wantModel:  "qwen",
+		},
+		{
+			name:       "azure",
+			cfg:        OpenAIConfig{AzureDeployment: "dep", MaxTokens: 100, Organization: "org"},
+			apiKey:     "azure-key",
+			wantPath:   "/openai/deployments/dep/chat/completions",
+			wantHeader: map[string]string{"Api-Key": "azure-key", "Authorization": "", "OpenAI-Organization": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				request *http.Request
+				body    map[string]interface{}
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				request = r.Clone(context.Background())
+				data, _ := io.ReadAll(r.Body)
+				if err := json.Unmarshal(data, &body); err != nil {
+					t.Errorf("invalid request body %s: %v", data, err)
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"choices": []interface{}{
+						map[string]interface{}{"message": map[string]interface{}{"content": "```\n// Foo does foo.\n```"}},
+					},
+				})
+			}))
+			defer server.Close()
+
+			o := &openAI{OpenAIConfig: tt.cfg, client: newHTTPClient("openai", server.URL, HTTPConfig{})}
+			o.APIKey = &tt.apiKey
+			o.URL = server.URL + "/v1"
+			if o.isAzure() {
+				o.URL = server.URL
+			}
+			if err := o.checkConfig(); err != nil {
+				t.Fatal(err)
+			}
+
+			comment, err := o.commentPrompt(context.Background(), "Comment Foo.")
+			if err != nil {
+				t.Fatalf("commentPrompt() error = %v", err)
+			}
+			if got := comment.Text(); got != "Foo does foo." {
+				t.Errorf("commentPrompt() = %q, want %q", got, "Foo does foo.")
+			}
+
+			if request.URL.Path != tt.wantPath {
+				t.Errorf("path = %q, want %q", request.URL.Path, tt.wantPath)
+			}
+			for name, want := range tt.wantHeader {
+				if got := request.Header.Get(name); got != want {
+					t.Errorf("header %s = %q, want %q", name, got, want)
+				}
+			}
+
+			if model, _ := body["model"].(string); model != tt.wantModel {
+				t.Errorf("model = %q, want %q", model, tt.wantModel)
+			}
+			// The compatible servers expect max_tokens, Azure
+			// max_completion_tokens.
+			tokensField := "max_tokens"
+			if o.isAzure() {
+				tokensField = "max_completion_tokens"
+			}
+			if body[tokensField] != float64(100) {
+				t.Errorf("body = %v, want %s 100", body, tokensField)
+			}
+		})
+	}
+}
@@ -0,0 +1,529 @@
+package comments
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// packagesLoadMode is the information loaded for the type-checked mode.
+// The types of the imported packages are read from their export data.
+const packagesLoadMode = packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles |
+	packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax | packages.NeedModule
+
+// defaultInterfaces are the interfaces of the standard library looked for
+// when the configuration does not list any.
+var defaultInterfaces = []string{
+	"fmt.Stringer",
+	"error",
+	"io.Reader",
+	"io.Writer",
+	"io.Closer",
+	"io.ReaderFrom",
+	"io.WriterTo",
+	"encoding.TextMarshaler",
+	"encoding.TextUnmarshaler",
+	"encoding/json.Marshaler",
+	"encoding/json.Unmarshaler",
+	"sort.Interface",
+	"net/http.Handler",
+}
+
+// PackageLoader loads the packages of the processed files with go/packages
+// to give the processors the resolved types of the declarations.
+// The packages are loaded once per directory. It is safe for concurrent use.
+type PackageLoader struct {
+	mu       sync.Mutex
+	packages map[string]*packages.Package
+	// imported are the packages loaded to find the configured interfaces.
+	imported map[string]*types.Package
+}
+
+// NewPackageLoader instantiates a new loader to enable the type-checked mode.
+func NewPackageLoader() *PackageLoader {
+	return &PackageLoader{
+		packages: make(map[string]*packages.Package),
+		imported: make(map[string]*types.Package),
+	}
+}
+
+// load returns the type-checked package containing the given file and the
+// syntax tree of the file in this package.
+func (l *PackageLoader) load(fileName string) (*packages.Package, *ast.File, error) {
+	absFilepath, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	dirPath := filepath.Dir(absFilepath)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pkg, ok := l.packages[dirPath]
+	if !ok {
+		pkgs, err := packages.Load(&packages.Config{
+			Mode: packagesLoadMode,
+			Dir:  dirPath,
+		}, "file="+absFilepath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(pkgs) == 0 {
+			return nil, nil, fmt.Errorf("no package found for %s", fileName)
+		}
+
+		pkg = pkgs[0]
+		l.packages[dirPath] = pkg
+	}
+
+	for i, goFile := range pkg.CompiledGoFiles {
+		if goFile == absFilepath && i < len(pkg.Syntax) {
+			return pkg, pkg.Syntax[i], nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("file %s not found in package %s", fileName, pkg.PkgPath)
+}
+
+// interfaces returns the interfaces a type of pkg may implement: the given
+// ones, like "io.Reader" or "example.com/mod/pkg.Iface", the default ones if
+// none is given, and the ones declared in the packages of the module.
+func (l *PackageLoader) interfaces(pkg *packages.Package, names []string) []namedInterface {
+	if len(names) == 0 {
+		names = defaultInterfaces
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Look for the packages in the imports first, to compare the types of
+	// the methods in the same type universe.
+	known := importedPackages(pkg.Types)
+
+	// The export data of the indirect imports only holds the objects used
+	// by the importing packages, so an interface may be missing there.
+	lookup := func(path, typeName string) types.Object {
+		if p := known[path]; p != nil {
+			if obj := p.Scope().Lookup(typeName); obj != nil {
+				return obj
+			}
+		}
+		if p := l.imported[path]; p != nil {
+			return p.Scope().Lookup(typeName)
+		}
+		return nil
+	}
+
+	var missing []string
+	for _, name := range names {
+		if path, typeName, ok := cutLast(name, "."); ok && lookup(path, typeName) == nil && l.imported[path] == nil {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) > 0 {
+		pkgs, err := packages.Load(&packages.Config{
+			Mode: packages.NeedName | packages.NeedTypes,
+			Dir:  filepath.Dir(pkg.GoFiles[0]),
+		}, missing...)
+		if err != nil {
+			log.Printf("fail to load the packages of the interfaces %v: %v", missing, err)
+		}
+		for _, p := range pkgs {
+			if p.Types != nil {
+				l.imported[p.PkgPath] = p.Types
+			}
+		}
+	}
+
+	var modulePath string
+	if pkg.Module != nil {
+		modulePath = pkg.Module.Path
+	}
+	return lookupInterfaces(names, lookup, known, modulePath)
+}
+
+// importedInterfaces returns the interfaces a type of pkg may implement,
+// like the interfaces of a PackageLoader but only looked for in pkg and its
+// imports, for the callers which can't load other packages, like a
+// go/analysis pass. The interfaces declared in the packages of the module
+// at modulePath are also returned when it is not empty.
+func importedInterfaces(pkg *types.Package, modulePath string, names []string) []namedInterface {
+	if len(names) == 0 {
+		names = defaultInterfaces
+	}
+
+	// The interfaces of the packages not imported are left out instead of
+	// being reported as not found.
+	known := importedPackages(pkg)
+	var imported []string
+	for _, name := range names {
+		if path, _, ok := cutLast(name, "."); !ok || known[path] != nil {
+			imported = append(imported, name)
+		}
+	}
+
+	lookup := func(path, typeName string) types.Object {
+		return known[path].Scope().Lookup(typeName)
+	}
+	return lookupInterfaces(imported, lookup, known, modulePath)
+}
+
+// importedPackages returns pkg and the packages it imports, directly or not,
+// by path.
+func importedPackages(pkg *types.Package) map[string]*types.Package {
+	known := make(map[string]*types.Package)
+	var walk func(p *types.Package)
+	walk = func(p *types.Package) {
+		if known[p.Path()] != nil {
+			return
+		}
+		known[p.Path()] = p
+		for _, imported := range p.Imports() {
+			walk(imported)
+		}
+	}
+	walk(pkg)
+	return known
+}
+
+// lookupInterfaces returns the interfaces of the given names found with
+// lookup, followed by the ones declared in the known packages of the module
+// at modulePath.
+func lookupInterfaces(names []string, lookup func(path, typeName string) types.Object, known map[string]*types.Package, modulePath string) []namedInterface {
+	var interfaces []namedInterface
+	for _, name := range names {
+		path, typeName, ok := cutLast(name, ".")
+		var obj types.Object
+		if ok {
+			obj = lookup(path, typeName)
+		} else {
+			obj = types.Universe.Lookup(name)
+		}
+
+		if obj == nil {
+			log.Printf("interface %s not found", name)
+			continue
+		}
+		interfaces = appendInterface(interfaces, obj)
+	}
+
+	if modulePath != "" {
+		// Sort the packages so that the implements sentences do not change
+		// between runs, which would make the signed comments stale.
+		paths := make([]string, 0, len(known))
+		for path := range known {
+			if path == modulePath || strings.HasPrefix(path, modulePath+"/") {
+				paths = append(paths, path)
+			}
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			scope := known[path].Scope()
+			for _, name := range scope.Names() {
+				interfaces = appendInterface(interfaces, scope.Lookup(name))
+			}
+		}
+	}
+
+	return interfaces
+}
+
+// namedInterface is an interface which may be implemented by the commented types.
+type namedInterface struct {
+	obj   *types.TypeName
+	iface *types.Interface
+}
+
+// appendInterface appends obj to interfaces if it is a non empty and non
+// generic interface which is not already in the list.
+func appendInterface(interfaces []namedInterface, obj types.Object) []namedInterface {
+	typeName, ok := obj.(*types.TypeName)
+	if !ok {
+		return interfaces
+	}
+
+	iface, ok := typeName.Type().Underlying().(*types.Interface)
+	if !ok || iface.NumMethods() == 0 {
+		return interfaces
+	}
+	if named, ok := typeName.Type().(*types.Named); ok && named.TypeParams().Len() > 0 {
+		return interfaces
+	}
+
+	for _, i := range interfaces {
+		if i.obj == typeName {
+			return interfaces
+		}
+	}
+
+	return append(interfaces, namedInterface{
+		obj:   typeName,
+		iface: iface,
+	})
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// typesInfo gives the resolved types of the declarations of a file in the
+// type-checked mode. A nil typesInfo is valid and falls back on the syntax.
+type typesInfo struct {
+	pkg  *types.Package
+	info *types.Info
+	// interfaces are the interfaces looked for in the implements sentences.
+	interfaces []namedInterface
+}
+
+// qualifier writes the other packages by their name, like in the source.
+func (t *typesInfo) qualifier(pkg *types.Package) string {
+	if pkg == t.pkg {
+		return ""
+	}
+	return pkg.Name()
+}
+
+// typeOf returns the resolved type of a type expression, or nil if unknown.
+func (t *typesInfo) typeOf(expr ast.Expr) types.Type {
+	if t == nil || expr == nil {
+		return nil
+	}
+	return t.info.TypeOf(expr)
+}
+
+// typeString returns the type of expr as written in the source.
+func (t *typesInfo) typeString(expr ast.Expr) string {
+	if typ := t.typeOf(expr); typ != nil && typ != types.Typ[types.Invalid] {
+		return types.TypeString(typ, t.qualifier)
+	}
+	return getTypeName(expr)
+}
+
+// varType returns the type of a declared variable or constant, inferred from
+// its value if the declaration has no explicit type.
+func (t *typesInfo) varType(spec *ast.ValueSpec, name *ast.Ident) string {
+	if spec.Type != nil {
+		return t.typeString(spec.Type)
+	}
+	if t == nil {
+		return ""
+	}
+
+	obj := t.info.Defs[name]
+	if obj == nil {
+		return ""
+	}
+	return types.TypeString(types.Default(obj.Type()), t.qualifier)
+}
+
+// kind returns the kind of the underlying type of expr, like "struct",
+// "interface" or "map", or "type" when it is not known.
+func (t *typesInfo) kind(expr ast.Expr) string {
+	typ := t.typeOf(expr)
+	if typ == nil {
+		return "type"
+	}
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+
+	switch typ.Underlying().(type) {
+	case *types.Struct:
+		return "struct"
+	case *types.Interface:
+		return "interface"
+	case *types.Map:
+		return "map"
+	case *types.Slice:
+		return "slice"
+	case *types.Array:
+		return "array"
+	case *types.Chan:
+		return "channel"
+	case *types.Signature:
+		return "function type"
+	default:
+		return "type"
+	}
+}
+
+// underlying returns the underlying type of a named type, or an empty string
+// if unknown.
+func (t *typesInfo) underlying(expr ast.Expr) string {
+	typ := t.typeOf(expr)
+	if typ == nil {
+		return ""
+	}
+	return types.TypeString(typ.Underlying(), t.qualifier)
+}
+
+// methods returns the sorted names of the methods of the named type of expr,
+// including the ones of its pointer and the promoted ones.
+func (t *typesInfo) methods(expr ast.Expr) []string {
+	typ := t.typeOf(expr)
+	if typ == nil {
+		return nil
+	}
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	if _, ok := typ.(*types.Named); !ok {
+		return nil
+	}
+
+	methodSet := types.NewMethodSet(types.NewPointer(typ))
+	if _, ok := typ.Underlying().(*types.Interface); ok {
+		methodSet = types.NewMethodSet(typ)
+	}
+
+	var names []string
+	for i := 0; i < methodSet.Len(); i++ {
+		names = append(names, methodSet.At(i).Obj().Name())
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// funcContext describes the named types used by the signature of fn, to give
+// their kind and methods to the AI providers which only see the signature.
+func (t *typesInfo) funcContext(fn *ast.FuncDecl) string {
+	if t == nil {
+		return ""
+	}
+
+	var fields []*ast.Field
+	for _, list := range []*ast.FieldList{fn.Recv, fn.Type.Params, fn.Type.Results} {
+		if list != nil {
+			fields = append(fields, list.List...)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var lines []string
+	for _, field := range fields {
+		typ := t.typeOf(field.Type)
+		if ptr, ok := typ.(*types.Pointer); ok {
+			typ = ptr.Elem()
+		}
+		named, ok := typ.(*types.Named)
+		if !ok {
+			continue
+		}
+
+		name := types.TypeString(named, t.qualifier)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		line := fmt.Sprintf("%s is %s", name, withArticle(t.kind(field.Type)))
+		if methods := t.methods(field.Type); len(methods) > 0 && len(methods) <= 10 {
+			line += " with the methods " + joinWords(methods)
+		}
+		lines = append(lines, line+".")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// interfaceName returns the name of an interface as written in the package.
+func (t *typesInfo) interfaceName(i namedInterface) string {
+	if i.obj.Pkg() == nil {
+		return i.obj.Name()
+	}
+	return types.TypeString(i.obj.Type(), t.qualifier)
+}
+
+// implements returns the interfaces implemented by the type declared by name
+// or by its pointer, like "io.Reader".
+func (t *typesInfo) implements(name *ast.Ident) []string {
+	if t == nil {
+		return nil
+	}
+
+	obj, ok := t.info.Defs[name].(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok || named.TypeParams().Len() > 0 {
+		return nil
+	}
+	if _, ok := named.Underlying().(*types.Interface); ok {
+		return nil
+	}
+
+	var names []string
+	for _, i := range t.interfaces {
+		if i.obj == obj {
+			continue
+		}
+		if types.Implements(named, i.iface) || types.Implements(types.NewPointer(named), i.iface) {
+			names = append(names, t.interfaceName(i))
+		}
+	}
+
+	return names
+}
+
+// implementedMethods returns the interface methods implemented by the method
+// fn, like "io.Reader.Read", for the interfaces its receiver implements.
+func (t *typesInfo) implementedMethods(fn *ast.FuncDecl) []string {
+	if t == nil || fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return nil
+	}
+
+	recvName := ""
+	switch recv := fn.Recv.List[0].Type.(type) {
+	case *ast.StarExpr:
+		if ident, ok := recv.X.(*ast.Ident); ok {
+			recvName = ident.Name
+		}
+	case *ast.Ident:
+		recvName = recv.Name
+	}
+	if recvName == "" {
+		return nil
+	}
+
+	obj := t.pkg.Scope().Lookup(recvName)
+	if obj == nil {
+		return nil
+	}
+
+	typeName, ok := obj.(*types.TypeName)
+	if !ok {
+		return nil
+	}
+
+	var methods []string
+	for _, i := range t.interfaces {
+		if i.obj == typeName {
+			continue
+		}
+		named := typeName.Type()
+		if !types.Implements(named, i.iface) && !types.Implements(types.NewPointer(named), i.iface) {
+			continue
+		}
+		for j := 0; j < i.iface.NumMethods(); j++ {
+			if i.iface.Method(j).Name() == fn.Name.Name {
+				methods = append(methods, t.interfaceName(i)+"."+fn.Name.Name)
+			}
+		}
+	}
+
+	return methods
+}
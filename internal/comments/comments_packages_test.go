@@ -0,0 +1,89 @@
+package comments
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTypeCheckedMode(t *testing.T) {
+	const src = `package a
+
+import "strings"
+
+type Client struct{ name string }
+
+func NewClient() *Client { return &Client{} }
+
+var Default = NewClient()
+
+var builder strings.Builder
+
+type Celsius float64
+
+func (c *Client) Name() string { return c.name }
+`
+
+	tests := []struct {
+		name    string
+		want    string
+		untyped string
+	}{
+		{
+			name:    "inferred variable type",
+			want:    "// Default is a variable of type *Client.\n",
+			untyped: "// Default is a variable.\n",
+		},
+		{
+			name:    "imported type",
+			want:    "// builder is a private variable of type strings.Builder.\n",
+			untyped: "// builder is a private variable of type strings.Builder.\n",
+		},
+		{
+			name:    "underlying type",
+			want:    "// Celsius is a defined type based on float64.\n",
+			untyped: "// Celsius is a defined type based on float64.\n",
+		},
+		{
+			name:    "method set",
+			want:    "// It has the Name method.\n",
+			untyped: "// It holds the name field.\n",
+		},
+	}
+
+	dir := testModule(t, "")
+	typed := processTestOptions(t, dir, src, Options{Packages: NewPackageLoader()})
+	untyped := processTest(t, dir, src)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(typed, tt.want) {
+				t.Errorf("Process() with types =\n%s\nwant it to contain %q", typed, tt.want)
+			}
+			if !strings.Contains(untyped, tt.untyped) {
+				t.Errorf("Process() without types =\n%s\nwant it to contain %q", untyped, tt.untyped)
+			}
+		})
+	}
+}
+
+func TestImplementsOrder(t *testing.T) {
+	dir := testModule(t, "")
+
+	var imports, uses strings.Builder
+	for _, name := range []string{"e", "b", "d", "a", "c", "f"} {
+		writeTestFile(t, filepath.Join(dir, name, name+".go"), "package "+name+"\n\n// Closer closes.\ntype Closer interface{ Close() error }\n")
+		imports.WriteString("\t\"example.com/test/" + name + "\"\n")
+		uses.WriteString("\t_ " + name + ".Closer = File{}\n")
+	}
+
+	src := "package main\n\nimport (\n" + imports.String() + ")\n\nvar (\n" + uses.String() + ")\n\ntype File struct{}\n\n// Close closes the file.\nfunc (File) Close() error { return nil }\n"
+	want := "// It implements io.Closer, a.Closer, b.Closer, c.Closer, d.Closer, e.Closer and f.Closer.\n"
+
+	for i := 0; i < 5; i++ {
+		got := processTestOptions(t, dir, src, Options{Packages: NewPackageLoader()})
+		if !strings.Contains(got, want) {
+			t.Fatalf("Process() =\n%s\nwant it to contain %q", got, want)
+		}
+	}
+}
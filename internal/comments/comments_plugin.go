@@ -0,0 +1,438 @@
+package comments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ariden/gocomments/provider"
+)
+
+// The defaults of the plugin providers.
+const (
+	defaultPluginTimeout = 60 * time.Second
+	pluginCloseTimeout   = 5 * time.Second
+)
+
+// PluginConfig is a provider running an external command. The command is
+// started once and kept running for all the files. It reads a request per
+// line on its stdin, like:
+//
+//	{"id":1,"version":1,"decl":{"kind":"func","name":"Open","signature":"func Open(name string) (*File, error)","body":"{...}","package":"os","file":"os/file.go"}}
+//
+// and writes a response per line on its stdout, with the id of the request:
+//
+//	{"id":1,"comment":"Open opens the named file for reading."}
+//
+// An empty comment leaves the declaration to the next provider, and an
+// "error" field reports a failure. The requests are sent without waiting for
+// the previous responses, which can be written in any order. Its stderr is
+// forwarded to the stderr of gocomments, and its stdin is closed at the end
+// of the run.
+type PluginConfig struct {
+	// Name is the name of the provider, used in the providers list.
+	Name   string `yaml:"name"`
+	Active *bool  `yaml:"active"`
+	// Command is the executable, looked for in the PATH, or relative to the
+	// directory of the .gocomments file when it contains a "/".
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	// Env are the environment variables added to the ones of gocomments,
+	// like "MODEL=small".
+	Env []string `yaml:"env"`
+	// Timeout is the maximum duration of each request, 60s by default. A
+	// plugin exceeding it is killed, and started again for the next file.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// dir is the directory of the .gocomments file declaring the plugin.
+	dir string
+}
+
+// path returns the path of the command.
+func (cfg PluginConfig) path() string {
+	if filepath.IsAbs(cfg.Command) || filepath.Base(cfg.Command) == cfg.Command || cfg.dir == "" {
+		return cfg.Command
+	}
+	return filepath.Join(cfg.dir, cfg.Command)
+}
+
+// mergePlugins returns the plugins overridden by the plugins of newPlugins
+// with the same name, followed by the new ones.
+func mergePlugins(plugins, newPlugins []PluginConfig) []PluginConfig {
+	merged := append([]PluginConfig(nil), plugins...)
+
+next:
+	for _, plugin := range newPlugins {
+		for i := range merged {
+			if merged[i].Name == plugin.Name {
+				merged[i] = plugin
+				continue next
+			}
+		}
+		merged = append(merged, plugin)
+	}
+	return merged
+}
+
+// plugin returns the configuration of the plugin with the given name.
+func (cfg *CommentConfig) plugin(name string) (PluginConfig, bool) {
+	for _, plugin := range cfg.Plugins {
+		if plugin.Name == name {
+			return plugin, true
+		}
+	}
+	return PluginConfig{}, false
+}
+
+type pluginProvider struct {
+	PluginConfig
+	jobs int
+}
+
+func (p *pluginProvider) isActive() bool {
+	return p.Active != nil && *p.Active
+}
+
+func (p *pluginProvider) checkConfig() error {
+	if p.Command == "" {
+		return fmt.Errorf("please set the command of the %s plugin in the plugins-command variable", p.PluginConfig.Name)
+	}
+	if _, err := exec.LookPath(p.path()); err != nil {
+		return fmt.Errorf("command of the %s plugin not found: %v", p.PluginConfig.Name, err)
+	}
+	if p.Timeout == 0 {
+		p.Timeout = defaultPluginTimeout
+	}
+	return nil
+}
+
+// Name returns the name of the plugin.
+func (p *pluginProvider) Name() string {
+	return p.PluginConfig.Name
+}
+
+func (p *pluginProvider) cacheModel() modelInfo {
+	return modelInfo{
+		Model:    p.Command,
+		Settings: append(append([]string(nil), p.Args...), p.Env...),
+	}
+}
+
+// Comment sends the declarations to the plugin process, up to jobs at once,
+// starting the process on the first call. The declarations failing are left
+// without comment, unless the process exits.
+func (p *pluginProvider) Comment(ctx context.Context, decls []provider.Decl) ([]provider.Comment, error) {
+	proc, err := sharedPlugin(p.PluginConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := p.jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	var (
+		comments = make([]provider.Comment, len(decls))
+		errs     = make([]error, len(decls))
+		sem      = make(chan struct{}, jobs)
+		wg       sync.WaitGroup
+	)
+	for i, decl := range decls {
+		if ctx.Err() != nil {
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, decl provider.Decl) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			reqCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+			defer cancel()
+
+			var txt string
+			txt, errs[i] = proc.call(reqCtx, decl)
+			comments[i] = parseComment(cleanComment(txt))
+		}(i, decl)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := proc.exitErr(); err != nil {
+		return nil, err
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("fail to generate comments with the %s plugin: fail to add comments on %s %s: %v", p.Name(), decls[i].Kind, decls[i].Name, err)
+		}
+	}
+
+	return comments, nil
+}
+
+// pluginRequest is a line sent to a plugin.
+type pluginRequest struct {
+	ID      uint64        `json:"id"`
+	Version int           `json:"version"`
+	Decl    provider.Decl `json:"decl"`
+}
+
+// pluginResponse is a line read from a plugin.
+type pluginResponse struct {
+	ID      uint64 `json:"id"`
+	Comment string `json:"comment"`
+	Error   string `json:"error"`
+}
+
+// pluginProcess is a running plugin. It is safe for concurrent use.
+type pluginProcess struct {
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan pluginResponse
+	err     error
+	// stopped is the reason why the plugin was killed, if it was.
+	stopped error
+
+	// done is closed when the process exited.
+	done chan struct{}
+}
+
+var (
+	pluginsMu sync.Mutex
+	// plugins are the running plugins, keyed by name and command, shared by
+	// all the files.
+	plugins = make(map[string]*pluginProcess)
+)
+
+// sharedPlugin returns the running process of the plugin, starting it on the
+// first call or after it exited.
+func sharedPlugin(cfg PluginConfig) (*pluginProcess, error) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+
+	key := cfg.Name + " " + cfg.path()
+	if proc, ok := plugins[key]; ok && proc.exitErr() == nil {
+		return proc, nil
+	}
+
+	proc, err := startPlugin(cfg)
+	if err != nil {
+		return nil, err
+	}
+	plugins[key] = proc
+	return proc, nil
+}
+
+// ClosePlugins closes the stdin of the running plugins and waits for them to
+// exit, killing the ones still running after a few seconds.
+func ClosePlugins() {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+
+	for key, proc := range plugins {
+		proc.close()
+		delete(plugins, key)
+	}
+}
+
+// startPlugin starts the command of the plugin.
+func startPlugin(cfg PluginConfig) (*pluginProcess, error) {
+	cmd := exec.Command(cfg.path(), cfg.Args...)
+	cmd.Env = append(os.Environ(), cfg.Env...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("fail to start the %s plugin: %v", cfg.Name, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("fail to start the %s plugin: %v", cfg.Name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("fail to start the %s plugin: %v", cfg.Name, err)
+	}
+
+	proc := &pluginProcess{
+		name:    cfg.Name,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[uint64]chan pluginResponse),
+		done:    make(chan struct{}),
+	}
+	go proc.read(stdout)
+
+	return proc, nil
+}
+
+// read dispatches the responses of the plugin to the pending requests, until
+// the plugin closes its stdout.
+func (p *pluginProcess) read(stdout io.Reader) {
+	dec := json.NewDecoder(stdout)
+	for {
+		var resp pluginResponse
+		if err := dec.Decode(&resp); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("invalid response of the %s plugin, stopping it: %v", p.name, err)
+				_ = p.cmd.Process.Kill()
+			}
+			break
+		}
+
+		p.mu.Lock()
+		ch, ok := p.pending[resp.ID]
+		delete(p.pending, resp.ID)
+		p.mu.Unlock()
+
+		if !ok {
+			log.Printf("unexpected response of the %s plugin with id %d", p.name, resp.ID)
+			continue
+		}
+		ch <- resp
+	}
+
+	exitErr := fmt.Errorf("the %s plugin exited", p.name)
+	if err := p.cmd.Wait(); err != nil {
+		exitErr = fmt.Errorf("the %s plugin exited: %v", p.name, err)
+	}
+
+	p.mu.Lock()
+	if p.stopped != nil {
+		exitErr = fmt.Errorf("the %s plugin was stopped: %v", p.name, p.stopped)
+	}
+	p.err = exitErr
+	p.mu.Unlock()
+	close(p.done)
+}
+
+// exitErr returns the reason of the exit of the plugin, or nil if it is
+// running.
+func (p *pluginProcess) exitErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// call sends decl to the plugin and waits for the comment. A plugin not
+// reading the request or not answering before the deadline of ctx is
+// killed, to be started again on the next run of the provider.
+func (p *pluginProcess) call(ctx context.Context, decl provider.Decl) (string, error) {
+	ch := make(chan pluginResponse, 1)
+
+	p.mu.Lock()
+	p.nextID++
+	id := p.nextID
+	p.pending[id] = ch
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+
+	line, err := json.Marshal(pluginRequest{
+		ID:      id,
+		Version: provider.Version,
+		Decl:    decl,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshalling request: %v", err)
+	}
+
+	// The write blocks while the plugin does not read its stdin: it is done
+	// in a goroutine, which ends with the plugin if it is killed.
+	written := make(chan error, 1)
+	go func() {
+		p.writeMu.Lock()
+		defer p.writeMu.Unlock()
+
+		_, err := p.stdin.Write(append(line, '\n'))
+		written <- err
+	}()
+
+	select {
+	case err := <-written:
+		if err != nil {
+			return "", fmt.Errorf("fail to write to the %s plugin: %v", p.name, err)
+		}
+	case <-p.done:
+		return "", p.exitErr()
+	case <-ctx.Done():
+		p.stopOnTimeout(ctx, "writing the request of %s %s", decl.Kind, decl.Name)
+		return "", ctx.Err()
+	}
+
+	var resp pluginResponse
+	select {
+	case resp = <-ch:
+	case <-p.done:
+		// The response may have been read right before the exit.
+		select {
+		case resp = <-ch:
+		default:
+			return "", p.exitErr()
+		}
+	case <-ctx.Done():
+		p.stopOnTimeout(ctx, "waiting for the comment of %s %s", decl.Kind, decl.Name)
+		return "", ctx.Err()
+	}
+
+	if resp.Error != "" {
+		return "", errors.New(resp.Error)
+	}
+	return resp.Comment, nil
+}
+
+// stopOnTimeout kills the plugin when the deadline of ctx exceeded while
+// doing the given action, but not when ctx was canceled.
+func (p *pluginProcess) stopOnTimeout(ctx context.Context, format string, args ...interface{}) {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return
+	}
+
+	reason := fmt.Errorf("timeout %s", fmt.Sprintf(format, args...))
+
+	p.mu.Lock()
+	first := p.stopped == nil
+	if first {
+		p.stopped = reason
+	}
+	p.mu.Unlock()
+
+	if first {
+		log.Printf("the %s plugin timed out, stopping it: %v", p.name, reason)
+		_ = p.cmd.Process.Kill()
+	}
+}
+
+// close closes the stdin of the plugin, which must then exit.
+func (p *pluginProcess) close() {
+	_ = p.stdin.Close()
+
+	select {
+	case <-p.done:
+	case <-time.After(pluginCloseTimeout):
+		_ = p.cmd.Process.Kill()
+		<-p.done
+	}
+}
@@ -0,0 +1,167 @@
+package comments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ariden/gocomments/provider"
+)
+
+// testPluginEnv is the environment variable running the test binary as a
+// plugin, in the mode given by its value.
+const testPluginEnv = "GOCOMMENTS_TEST_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(testPluginEnv); mode != "" {
+		runTestPlugin(mode)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runTestPlugin answers the requests like a plugin. In the "stuck" mode, it
+// does not read its stdin, and in the "silent" mode it does not answer.
+// Otherwise, the declarations named "Bad" fail and the ones named "Skip" are
+// left without comment.
+func runTestPlugin(mode string) {
+	if mode == "stuck" {
+		time.Sleep(time.Minute)
+		return
+	}
+
+	dec := json.NewDecoder(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		var req pluginRequest
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+
+		resp := pluginResponse{ID: req.ID}
+		switch {
+		case mode == "silent":
+			continue
+		case req.Decl.Name == "Bad":
+			resp.Error = "bad declaration"
+		case req.Decl.Name == "Skip":
+		default:
+			resp.Comment = fmt.Sprintf("// %s is a %s, protocol version %d.", req.Decl.Name, req.Decl.Kind, req.Version)
+		}
+		_ = enc.Encode(resp)
+	}
+}
+
+// testPlugin returns the provider running the test binary as a plugin in
+// the given mode.
+func testPlugin(t *testing.T, mode string, timeout time.Duration) *pluginProvider {
+	t.Helper()
+	t.Cleanup(ClosePlugins)
+
+	active := true
+	p := &pluginProvider{
+		PluginConfig: PluginConfig{
+			Name:    strings.ReplaceAll(t.Name(), "/", "-"),
+			Active:  &active,
+			Command: os.Args[0],
+			Env:     []string{testPluginEnv + "=" + mode},
+			Timeout: timeout,
+		},
+		jobs: 2,
+	}
+	if err := p.checkConfig(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPluginProtocol(t *testing.T) {
+	p := testPlugin(t, "answer", 0)
+	if p.Timeout != defaultPluginTimeout {
+		t.Errorf("timeout = %v, want the default %v", p.Timeout, defaultPluginTimeout)
+	}
+
+	decls := []provider.Decl{
+		{Kind: provider.KindFunc, Name: "Foo"},
+		{Kind: provider.KindType, Name: "Bad"},
+		{Kind: provider.KindType, Name: "Skip"},
+		{Kind: provider.KindConst, Name: "Bar"},
+	}
+	want := []string{
+		"Foo is a func, protocol version 1.",
+		"",
+		"",
+		"Bar is a const, protocol version 1.",
+	}
+
+	// The process is kept running between the calls.
+	for run := 0; run < 2; run++ {
+		comments, err := p.Comment(context.Background(), decls)
+		if err != nil {
+			t.Fatalf("Comment() error = %v", err)
+		}
+		for i, comment := range comments {
+			if got := comment.Text(); got != want[i] {
+				t.Errorf("run %d: Comment()[%d] = %q, want %q", run, i, got, want[i])
+			}
+		}
+	}
+}
+
+func TestPluginTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		decl provider.Decl
+	}{
+		{
+			name: "not answering",
+			mode: "silent",
+			decl: provider.Decl{Kind: provider.KindFunc, Name: "Foo"},
+		},
+		{
+			// The request is larger than the buffer of the pipe.
+			name: "not reading",
+			mode: "stuck",
+			decl: provider.Decl{Kind: provider.KindFunc, Name: "Foo", Body: strings.Repeat("x", 1<<20)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPlugin(t, tt.mode, 100*time.Millisecond)
+			proc, err := sharedPlugin(p.PluginConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan []provider.Comment, 1)
+			go func() {
+				comments, _ := p.Comment(context.Background(), []provider.Decl{tt.decl})
+				done <- comments
+			}()
+
+			select {
+			case comments := <-done:
+				if len(comments) > 0 && !comments[0].IsZero() {
+					t.Errorf("Comment() = %q, want no comment", comments[0].Text())
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("Comment() blocked after the timeout")
+			}
+
+			select {
+			case <-proc.done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("plugin not stopped after the timeout")
+			}
+			if err := proc.exitErr(); err == nil || !strings.Contains(err.Error(), "stopped: timeout") {
+				t.Errorf("exitErr() = %v, want a stop on timeout", err)
+			}
+		})
+	}
+}
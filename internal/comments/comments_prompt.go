@@ -0,0 +1,261 @@
+package comments
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/ariden/gocomments/provider"
+)
+
+// defaultFuncPrompt is the prompt template of the functions and the methods
+// when the configuration does not set one.
+const defaultFuncPrompt = `Write the doc comment of the following Go function. Describe its purpose, its parameters and return values, its error conditions and its side effects:
+{{.Signature}}
+{{- if .Context}}
+
+With the types:
+{{.Context}}
+{{- end}}
+{{- if .Errors}}
+
+Error conditions found in its body:
+{{join .Errors "\n"}}
+{{- end}}
+{{- if .Effects}}
+
+Side effects and concurrency found in its body:
+{{join .Effects "\n"}}
+{{- end}}`
+
+// PromptConfig are the text/template templates of the prompts sent to the AI
+// providers, by kind of declaration. The method prompts default to the func
+// prompt. The types, the variables and the constants are only commented by
+// the AI providers when they have a prompt.
+type PromptConfig struct {
+	Func   string `yaml:"func"`
+	Method string `yaml:"method"`
+	Type   string `yaml:"type"`
+	Var    string `yaml:"var"`
+	Const  string `yaml:"const"`
+}
+
+// Merge returns the templates overridden by the ones set in newCfg.
+func (cfg PromptConfig) Merge(newCfg PromptConfig) PromptConfig {
+	if newCfg.Func != "" {
+		cfg.Func = newCfg.Func
+	}
+	if newCfg.Method != "" {
+		cfg.Method = newCfg.Method
+	}
+	if newCfg.Type != "" {
+		cfg.Type = newCfg.Type
+	}
+	if newCfg.Var != "" {
+		cfg.Var = newCfg.Var
+	}
+	if newCfg.Const != "" {
+		cfg.Const = newCfg.Const
+	}
+	return cfg
+}
+
+// template returns the template of the given kind, or an empty string if
+// the declarations of this kind have no prompt.
+func (cfg PromptConfig) template(kind provider.Kind) string {
+	switch kind {
+	case provider.KindMethod:
+		if cfg.Method != "" {
+			return cfg.Method
+		}
+		fallthrough
+	case provider.KindFunc:
+		if cfg.Func != "" {
+			return cfg.Func
+		}
+		return defaultFuncPrompt
+	case provider.KindType:
+		return cfg.Type
+	case provider.KindVar:
+		return cfg.Var
+	case provider.KindConst:
+		return cfg.Const
+	default:
+		return ""
+	}
+}
+
+// promptData is the data of the prompt templates: the fields of the
+// declaration, like .Name, .Signature, .Body or .File, and its context in the
+// file.
+type promptData struct {
+	provider.Decl
+	// Receiver is the receiver of a method, like "s *Store".
+	Receiver string
+	// PackageDoc is the doc comment of the package.
+	PackageDoc string
+	// Siblings are the signatures of the other top-level declarations of
+	// the file.
+	Siblings []string
+}
+
+// defaultFuncTemplate is the parsed defaultFuncPrompt.
+var defaultFuncTemplate = template.Must(template.New("func").Funcs(templateFuncs).Parse(defaultFuncPrompt))
+
+// funcPrompt returns the default prompt of a function, from its descriptor
+// only.
+func funcPrompt(decl provider.Decl) string {
+	txt, err := renderPrompt(defaultFuncTemplate, promptData{Decl: decl})
+	if err != nil {
+		return decl.Signature
+	}
+	return txt
+}
+
+// renderPrompt executes the template tmpl with data.
+func renderPrompt(tmpl *template.Template, data promptData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// prompt returns the prompt of decl rendered from the template of its kind,
+// or an empty string if it has no template.
+func (file *file) prompt(decl provider.Decl) (string, error) {
+	tmpl, err := file.promptTemplate(decl.Kind)
+	if err != nil || tmpl == nil {
+		return "", err
+	}
+
+	data := promptData{
+		Decl:       decl,
+		PackageDoc: file.packageDoc(),
+		Siblings:   file.siblings(decl),
+	}
+	if fn, ok := decl.Node.(*ast.FuncDecl); ok && fn.Recv != nil && len(fn.Recv.List) > 0 {
+		recv := fn.Recv.List[0]
+		data.Receiver = getTypeName(recv.Type)
+		if len(recv.Names) > 0 {
+			data.Receiver = recv.Names[0].Name + " " + data.Receiver
+		}
+	}
+
+	txt, err := renderPrompt(tmpl, data)
+	if err != nil {
+		return "", fmt.Errorf("fail to render the %s prompt of %s: %v", decl.Kind, decl.Name, err)
+	}
+	return txt, nil
+}
+
+// promptTemplate returns the parsed template of the given kind, or nil if
+// there is none. The templates are parsed once per file.
+func (file *file) promptTemplate(kind provider.Kind) (*template.Template, error) {
+	if tmpl, ok := file.templates[kind]; ok {
+		return tmpl, nil
+	}
+
+	var tmpl *template.Template
+	if txt := file.cfg.Prompts.template(kind); txt != "" {
+		var err error
+		tmpl, err = template.New(string(kind)).Funcs(templateFuncs).Parse(txt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s prompt template: %v", kind, err)
+		}
+	}
+
+	if file.templates == nil {
+		file.templates = make(map[provider.Kind]*template.Template)
+	}
+	file.templates[kind] = tmpl
+	return tmpl, nil
+}
+
+// packageDoc returns the doc comment of the package, read from the file or
+// else from the other Go files of its directory. It is read once per file.
+func (file *file) packageDoc() string {
+	if file.pkgDoc == nil {
+		doc := file.readPackageDoc()
+		file.pkgDoc = &doc
+	}
+	return *file.pkgDoc
+}
+
+// readPackageDoc reads the doc comment of the package.
+func (file *file) readPackageDoc() string {
+	if file.f.Doc != nil {
+		return strings.TrimSpace(file.f.Doc.Text())
+	}
+
+	paths, err := filepath.Glob(filepath.Join(filepath.Dir(file.fileName), "*.go"))
+	if err != nil {
+		return ""
+	}
+	for _, path := range paths {
+		if path == file.fileName || strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), path, src, parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil || f.Name.Name != file.f.Name.Name || f.Doc == nil {
+			continue
+		}
+		return strings.TrimSpace(f.Doc.Text())
+	}
+	return ""
+}
+
+// sibling is the signature of a top-level declaration of the file.
+type sibling struct {
+	node      ast.Node
+	signature string
+}
+
+// siblings returns the signatures of the top-level declarations of the file
+// other than decl. The signatures are rendered once per file.
+func (file *file) siblings(decl provider.Decl) []string {
+	if file.topLevel == nil {
+		file.topLevel = file.readSiblings()
+	}
+
+	var siblings []string
+	for _, s := range file.topLevel {
+		if s.node != decl.Node {
+			siblings = append(siblings, s.signature)
+		}
+	}
+	return siblings
+}
+
+// readSiblings renders the signatures of the top-level declarations.
+func (file *file) readSiblings() []sibling {
+	siblings := []sibling{}
+	for _, d := range file.f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			siblings = append(siblings, sibling{d, GenerateFuncCode(d)})
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					siblings = append(siblings, sibling{spec, typeSpecString(spec)})
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						siblings = append(siblings, sibling{spec, strings.TrimSpace(d.Tok.String() + " " + name.Name + " " + file.types.varType(spec, name))})
+					}
+				}
+			}
+		}
+	}
+	return siblings
+}
@@ -0,0 +1,182 @@
+package comments
+
+import (
+	"context"
+	"go/ast"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ariden/gocomments/provider"
+)
+
+func TestPromptConfigTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  PromptConfig
+		kind provider.Kind
+		want string
+	}{
+		{name: "default func", kind: provider.KindFunc, want: defaultFuncPrompt},
+		{name: "default method", kind: provider.KindMethod, want: defaultFuncPrompt},
+		{name: "method from func", cfg: PromptConfig{Func: "func"}, kind: provider.KindMethod, want: "func"},
+		{name: "method", cfg: PromptConfig{Func: "func", Method: "method"}, kind: provider.KindMethod, want: "method"},
+		{name: "type without prompt", kind: provider.KindType},
+		{name: "type", cfg: PromptConfig{Type: "type"}, kind: provider.KindType, want: "type"},
+		{name: "var", cfg: PromptConfig{Var: "var"}, kind: provider.KindVar, want: "var"},
+		{name: "const", cfg: PromptConfig{Const: "const"}, kind: provider.KindConst, want: "const"},
+		{name: "field", cfg: PromptConfig{Func: "func", Type: "type"}, kind: provider.KindField},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.template(tt.kind); got != tt.want {
+				t.Errorf("template() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilePrompt(t *testing.T) {
+	const config = `prompts:
+  method: "{{.Name}} of {{.Receiver}} in {{.File}}: {{.PackageDoc}} Siblings: {{join .Siblings \", \"}}."
+  type: "Type {{.Name}}{{if .Receiver}} with a receiver{{end}}."
+`
+	const src = `package a
+
+type Store struct{}
+
+func (s *Store) Get(key string) string { return "" }
+
+const Max = 10
+`
+
+	dir := testModule(t, config)
+	writeTestFile(t, filepath.Join(dir, "doc.go"), "// Package a stores things.\npackage a\n")
+	writeTestFile(t, filepath.Join(dir, "sub", ".gocomments"), "prompts:\n  type: \"Sub {{.Name}}.\"\n")
+
+	tests := []struct {
+		name string
+		dir  string
+		kind provider.Kind
+		want string
+	}{
+		{
+			name: "method",
+			dir:  dir,
+			kind: provider.KindMethod,
+			want: "Get of s *Store in " + filepath.Join(dir, "a.go") + ": Package a stores things. Siblings: type Store struct{}, const Max.",
+		},
+		{
+			name: "type",
+			dir:  dir,
+			kind: provider.KindType,
+			want: "Type Store.",
+		},
+		{
+			name: "const without prompt",
+			dir:  dir,
+			kind: provider.KindConst,
+		},
+		{
+			name: "type in a subdirectory",
+			dir:  filepath.Join(dir, "sub"),
+			kind: provider.KindType,
+			want: "Sub Store.",
+		},
+		{
+			name: "method in a subdirectory",
+			dir:  filepath.Join(dir, "sub"),
+			kind: provider.KindMethod,
+			want: "Get of s *Store in " + filepath.Join(dir, "sub", "a.go") + ":  Siblings: type Store struct{}, const Max.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := newTestFile(t, tt.dir, src)
+
+			got, err := file.prompt(testDecl(t, file, tt.kind))
+			if err != nil {
+				t.Fatalf("prompt() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("prompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilePromptInvalidTemplate(t *testing.T) {
+	dir := testModule(t, "prompts:\n  func: \"{{.Name\"\n")
+	file := newTestFile(t, dir, "package a\n\nfunc Foo() {}\n")
+
+	_, err := file.prompt(testDecl(t, file, provider.KindFunc))
+	if err == nil || !strings.Contains(err.Error(), "invalid func prompt template") {
+		t.Errorf("prompt() error = %v, want an invalid template error", err)
+	}
+}
+
+func TestProcessRendersPromptsLazily(t *testing.T) {
+	const src = "package a\n\nfunc Foo() {}\n"
+	server, _, _ := anthropicServer(t, "Foo does foo.")
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{
+			name:   "default provider",
+			config: "prompts:\n  func: \"{{.Name\"\n",
+		},
+		{
+			name:    "AI provider",
+			config:  "prompts:\n  func: \"{{.Name\"\nanthropic:\n  active: true\n  url: " + server.URL + "\n  api-key: sk-test\n  model: claude\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, tt.config)
+			path := filepath.Join(dir, "a.go")
+			writeTestFile(t, path, src)
+
+			_, err := Process(context.Background(), path, []byte(src), NewConfigCache("", nil), Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Process() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testDecl returns the descriptor of the first declaration of the given kind
+// of the file.
+func testDecl(t *testing.T, file *file, kind provider.Kind) provider.Decl {
+	t.Helper()
+
+	for _, d := range file.f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if (d.Recv != nil) == (kind == provider.KindMethod) && (kind == provider.KindFunc || kind == provider.KindMethod) {
+				return file.newDecl(kind, d.Name.Name, d)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if kind == provider.KindType {
+						return file.newDecl(kind, spec.Name.Name, spec)
+					}
+				case *ast.ValueSpec:
+					if string(kind) == d.Tok.String() {
+						return file.newDecl(kind, spec.Names[0].Name, spec)
+					}
+				}
+			}
+		}
+	}
+	t.Fatalf("no %s declaration", kind)
+	return provider.Decl{}
+}
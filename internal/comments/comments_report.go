@@ -0,0 +1,96 @@
+package comments
+
+import (
+	"fmt"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ariden/gocomments/provider"
+)
+
+// ReportEntry is a comment generated by a provider.
+type ReportEntry struct {
+	Position token.Position
+	Kind     provider.Kind
+	Name     string
+	Provider string
+}
+
+// String returns the "file:line:col: message" representation of the entry.
+func (e ReportEntry) String() string {
+	return fmt.Sprintf("%s: %s %s commented by %s", e.Position, e.Kind, e.Name, e.Provider)
+}
+
+// Report records the provider which generated each comment of a run.
+// It is safe for concurrent use.
+type Report struct {
+	mu      sync.Mutex
+	entries []ReportEntry
+}
+
+// NewReport instantiates an empty report.
+func NewReport() *Report {
+	return &Report{}
+}
+
+// add records an entry. It does nothing on a nil report.
+func (r *Report) add(entry ReportEntry) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, entry)
+}
+
+// Entries returns the recorded entries sorted by position.
+func (r *Report) Entries() []ReportEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := append([]ReportEntry(nil), r.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].Position, entries[j].Position
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+	return entries
+}
+
+// Write writes the entries of the report followed by the number of comments
+// generated by each provider.
+func (r *Report) Write(w io.Writer) error {
+	entries := r.Entries()
+
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		if _, err := fmt.Fprintln(w, entry); err != nil {
+			return err
+		}
+		counts[entry.Provider]++
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	summary := fmt.Sprintf("%d %s generated", len(entries), pluralize("comment", len(entries)))
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%d by %s", counts[name], name)
+	}
+	if len(names) > 0 {
+		summary += ": " + strings.Join(names, ", ")
+	}
+
+	_, err := fmt.Fprintln(w, summary)
+	return err
+}
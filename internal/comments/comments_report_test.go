@@ -0,0 +1,115 @@
+package comments
+
+import (
+	"bytes"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ariden/gocomments/provider"
+)
+
+func TestReportWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []ReportEntry
+		want    string
+	}{
+		{
+			name: "empty",
+			want: "0 comments generated\n",
+		},
+		{
+			name: "sorted by position",
+			entries: []ReportEntry{
+				{Position: token.Position{Filename: "b.go", Offset: 10, Line: 2, Column: 1}, Kind: provider.KindFunc, Name: "B", Provider: "openai"},
+				{Position: token.Position{Filename: "a.go", Offset: 30, Line: 5, Column: 1}, Kind: provider.KindType, Name: "T", Provider: "default"},
+				{Position: token.Position{Filename: "a.go", Offset: 10, Line: 2, Column: 1}, Kind: provider.KindFunc, Name: "A", Provider: "openai"},
+			},
+			want: "a.go:2:1: func A commented by openai\n" +
+				"a.go:5:1: type T commented by default\n" +
+				"b.go:2:1: func B commented by openai\n" +
+				"3 comments generated: 1 by default, 2 by openai\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewReport()
+			for _, entry := range tt.entries {
+				report.add(entry)
+			}
+
+			var buf bytes.Buffer
+			if err := report.Write(&buf); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Write() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessReport(t *testing.T) {
+	const src = `package a
+
+// Documented is documented.
+func Documented() {}
+
+func Foo() {}
+
+type T int
+`
+
+	dir := testModule(t, "")
+	report := NewReport()
+	processTestOptions(t, dir, src, Options{Report: report})
+
+	var got []string
+	for _, entry := range report.Entries() {
+		entry.Position.Filename = filepath.Base(entry.Position.Filename)
+		got = append(got, entry.String())
+	}
+	want := []string{
+		"a.go:6:1: func Foo commented by default",
+		"a.go:8:6: type T commented by default",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("report = %q, want %q", got, want)
+	}
+}
+
+func TestProcessReportAIProvider(t *testing.T) {
+	const src = `package a
+
+func Foo() {}
+
+type T struct {
+	Name string
+}
+
+const Max = 1
+`
+
+	server, _, _ := anthropicServer(t, "Foo does foo.")
+	dir := testModule(t, "anthropic:\n  active: true\n  url: "+server.URL+"\n  api-key: sk-test\n  model: claude\n")
+	report := NewReport()
+	processTestOptions(t, dir, src, Options{Report: report})
+
+	var got []string
+	for _, entry := range report.Entries() {
+		entry.Position.Filename = filepath.Base(entry.Position.Filename)
+		got = append(got, entry.String())
+	}
+	want := []string{
+		"a.go:3:1: func Foo commented by anthropic",
+		"a.go:5:6: type T commented by default",
+		"a.go:6:2: field Name commented by default",
+		"a.go:9:7: const Max commented by default",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("report = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,181 @@
+package comments
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hunkRegexp matches the header of a hunk of a unified diff, capturing the
+// first line and the number of lines of the new version.
+var hunkRegexp = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// lineRange is a range of lines, First and Last included.
+type lineRange struct {
+	First int
+	Last  int
+}
+
+// Changes are the lines added or modified in the files of git repositories
+// since a revision. Only the declarations overlapping these lines are
+// commented.
+type Changes struct {
+	// files are the changed lines by absolute path, nil for the new files
+	// which are changed as a whole.
+	files map[string][]lineRange
+}
+
+// GitChanges returns the lines changed since the revision rev in the git
+// repositories of the given paths, as given by "git diff rev", so that rev
+// can be a commit, a branch or a range like "main...". The untracked files
+// are changed as a whole. The lines only removed are not changes, as their
+// declarations do not need a new comment.
+func GitChanges(rev string, paths []string) (*Changes, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return nil, fmt.Errorf("invalid revision %q", rev)
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	changes := &Changes{files: make(map[string][]lineRange)}
+
+	roots := make(map[string]bool)
+	for _, path := range paths {
+		dir := path
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			dir = filepath.Dir(path)
+		}
+
+		root, err := git(dir, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return nil, err
+		}
+		root = strings.TrimSpace(root)
+		if roots[root] {
+			continue
+		}
+		roots[root] = true
+
+		diff, err := git(root, "diff", "--unified=0", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/", rev, "--")
+		if err != nil {
+			return nil, err
+		}
+		if err := changes.parseDiff(root, diff); err != nil {
+			return nil, err
+		}
+
+		untracked, err := git(root, "ls-files", "--others", "--exclude-standard", "-z")
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range strings.Split(untracked, "\x00") {
+			if name != "" {
+				changes.files[canonicalPath(filepath.Join(root, name))] = nil
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// git runs a git command in dir and returns its output.
+func git(dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// parseDiff records the lines added or modified by a unified diff of the
+// repository at root, without context lines.
+func (c *Changes) parseDiff(root, diff string) error {
+	var current string
+
+	s := bufio.NewScanner(strings.NewReader(diff))
+	s.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			current = ""
+			name := strings.TrimPrefix(line, "+++ ")
+			if strings.HasPrefix(name, `"`) {
+				unquoted, err := strconv.Unquote(name)
+				if err != nil {
+					return fmt.Errorf("invalid file name in the diff: %s", name)
+				}
+				name = unquoted
+			}
+			if name, ok := strings.CutPrefix(name, "b/"); ok {
+				current = canonicalPath(filepath.Join(root, name))
+			}
+		case strings.HasPrefix(line, "@@ ") && current != "":
+			m := hunkRegexp.FindStringSubmatch(line)
+			if m == nil {
+				return fmt.Errorf("invalid hunk header in the diff: %s", line)
+			}
+			first, _ := strconv.Atoi(m[1])
+			count := 1
+			if m[2] != "" {
+				count, _ = strconv.Atoi(m[2])
+			}
+			if count == 0 {
+				continue
+			}
+			c.files[current] = append(c.files[current], lineRange{First: first, Last: first + count - 1})
+		}
+	}
+	return s.Err()
+}
+
+// canonicalPath returns the absolute path of path with the symbolic links
+// resolved, so that the paths given by git and on the command line match.
+func canonicalPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return path
+}
+
+// Contains tells whether the file at path has changes. A nil Changes
+// contains all the files.
+func (c *Changes) Contains(path string) bool {
+	if c == nil {
+		return true
+	}
+	_, ok := c.files[canonicalPath(path)]
+	return ok
+}
+
+// overlaps tells whether the lines first to last of the file at the
+// canonical path have changes.
+func (c *Changes) overlaps(path string, first, last int) bool {
+	ranges, ok := c.files[path]
+	if !ok {
+		return false
+	}
+	if ranges == nil {
+		return true
+	}
+	for _, r := range ranges {
+		if r.First <= last && first <= r.Last {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+package comments
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+	root := canonicalPath(t.TempDir())
+
+	tests := []struct {
+		name    string
+		diff    string
+		want    map[string][]lineRange
+		wantErr bool
+	}{
+		{
+			name: "modified file",
+			diff: `diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -3 +3 @@ package a
+-func Foo() {}
++func Foo(x int) {}
+@@ -10,0 +11,3 @@ func Bar() {}
++
++func Baz() {}
++
+`,
+			want: map[string][]lineRange{
+				"a.go": {{First: 3, Last: 3}, {First: 11, Last: 13}},
+			},
+		},
+		{
+			name: "removed lines only",
+			diff: `--- a/a.go
++++ b/a.go
+@@ -5,2 +4,0 @@ package a
+-func Foo() {}
+-
+`,
+			want: map[string][]lineRange{},
+		},
+		{
+			name: "deleted and added files",
+			diff: `--- a/old.go
++++ /dev/null
+@@ -1,3 +0,0 @@
+-package a
+--- /dev/null
++++ b/sub/new.go
+@@ -0,0 +1,2 @@
++package sub
++
+`,
+			want: map[string][]lineRange{
+				filepath.Join("sub", "new.go"): {{First: 1, Last: 2}},
+			},
+		},
+		{
+			name: "quoted file name",
+			diff: `--- "a/caf\303\251.go"
++++ "b/caf\303\251.go"
+@@ -1 +1 @@
+-package a
++package b
+`,
+			want: map[string][]lineRange{
+				"café.go": {{First: 1, Last: 1}},
+			},
+		},
+		{
+			name: "invalid quoted file name",
+			diff: `+++ "b/a.go
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid hunk header",
+			diff: `+++ b/a.go
+@@ -1 +x @@
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := &Changes{files: make(map[string][]lineRange)}
+			err := changes.parseDiff(root, tt.diff)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDiff() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			want := make(map[string][]lineRange, len(tt.want))
+			for name, ranges := range tt.want {
+				want[filepath.Join(root, name)] = ranges
+			}
+			if !reflect.DeepEqual(changes.files, want) {
+				t.Errorf("parseDiff() = %v, want %v", changes.files, want)
+			}
+		})
+	}
+}
+
+func TestChangesOverlaps(t *testing.T) {
+	changes := &Changes{files: map[string][]lineRange{
+		"/a.go":   {{First: 3, Last: 3}, {First: 10, Last: 12}},
+		"/new.go": nil,
+	}}
+
+	tests := []struct {
+		name  string
+		path  string
+		first int
+		last  int
+		want  bool
+	}{
+		{name: "changed line", path: "/a.go", first: 3, last: 3, want: true},
+		{name: "declaration around the change", path: "/a.go", first: 1, last: 5, want: true},
+		{name: "declaration ending on the change", path: "/a.go", first: 7, last: 10, want: true},
+		{name: "declaration starting on the change", path: "/a.go", first: 12, last: 20, want: true},
+		{name: "declaration between the changes", path: "/a.go", first: 4, last: 9},
+		{name: "declaration after the changes", path: "/a.go", first: 13, last: 15},
+		{name: "new file", path: "/new.go", first: 1, last: 1, want: true},
+		{name: "unchanged file", path: "/b.go", first: 1, last: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := changes.overlaps(tt.path, tt.first, tt.last); got != tt.want {
+				t.Errorf("overlaps(%d, %d) = %v, want %v", tt.first, tt.last, got, tt.want)
+			}
+		})
+	}
+
+	var all *Changes
+	if !all.Contains("/b.go") {
+		t.Error("nil Changes does not contain all the files")
+	}
+}
+
+func TestGitChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	root := canonicalPath(t.TempDir())
+	run := func(args ...string) {
+		t.Helper()
+		if _, err := git(root, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("init", "-q")
+	run("config", "user.email", "test@example.com")
+	run("config", "user.name", "test")
+	run("config", "commit.gpgsign", "false")
+	writeTestFile(t, filepath.Join(root, "a.go"), "package a\n\nfunc Foo() {}\n")
+	writeTestFile(t, filepath.Join(root, "b.go"), "package a\n")
+	run("add", ".")
+	run("commit", "-q", "-m", "initial")
+
+	writeTestFile(t, filepath.Join(root, "a.go"), "package a\n\nfunc Foo() {}\n\nfunc Bar() {}\n")
+	writeTestFile(t, filepath.Join(root, "c.go"), "package a\n")
+
+	tests := []struct {
+		rev     string
+		want    map[string][]lineRange
+		wantErr string
+	}{
+		{
+			rev: "HEAD",
+			want: map[string][]lineRange{
+				filepath.Join(root, "a.go"): {{First: 4, Last: 5}},
+				filepath.Join(root, "c.go"): nil,
+			},
+		},
+		{rev: "-p", wantErr: "invalid revision"},
+		{rev: "unknown", wantErr: "git diff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rev, func(t *testing.T) {
+			changes, err := GitChanges(tt.rev, []string{filepath.Join(root, "a.go")})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GitChanges() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GitChanges() error = %v", err)
+			}
+			if !reflect.DeepEqual(changes.files, tt.want) {
+				t.Errorf("GitChanges() = %v, want %v", changes.files, tt.want)
+			}
+			if changes.Contains(filepath.Join(root, "b.go")) {
+				t.Error("Contains() = true on the unchanged b.go")
+			}
+		})
+	}
+}
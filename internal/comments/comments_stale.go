@@ -0,0 +1,81 @@
+package comments
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// signatureRegexp matches the end of the signature trailer, after the
+// signature itself, capturing the optional declaration fingerprint.
+var signatureRegexp = regexp.MustCompile(`^(?: #([0-9a-f]{8}))?\.$`)
+
+// CheckStale returns the generated comments of the given Go source file
+// whose declaration fingerprint does not match anymore. The source is not
+// modified and no comment is generated.
+func CheckStale(fileName string, src []byte, cache *CommentConfigCache) ([]Finding, error) {
+	findings, err := Check(fileName, src, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []Finding
+	for _, finding := range findings {
+		if finding.Rule == RuleStale {
+			stale = append(stale, finding)
+		}
+	}
+	return stale, nil
+}
+
+// fingerprint returns a compact hash of the given declaration description,
+// stored in the signature of the generated comments to detect the changes.
+func fingerprint(decl string) string {
+	sum := sha256.Sum256([]byte(decl))
+	return hex.EncodeToString(sum[:4])
+}
+
+// funcFingerprint returns the fingerprint of a function: its signature and
+// the errors, panics and effects found in its body, which its generated
+// comment describes. The body is analysed without the types, so that the
+// fingerprint does not depend on the type-checked mode.
+func funcFingerprint(fn *ast.FuncDecl) string {
+	var untyped *typesInfo
+	parts := []string{GenerateFuncCode(fn)}
+	parts = append(parts, untyped.analyzeErrors(fn).describe()...)
+	parts = append(parts, untyped.analyzeEffects(fn).describe()...)
+	return fingerprint(strings.Join(parts, "\n"))
+}
+
+// nodeFingerprint returns the fingerprint of the source of a type, var or
+// const spec. The source is tokenized so that the comments, including the
+// field ones, and the formatting do not change the fingerprint.
+func (file *file) nodeFingerprint(node ast.Node) string {
+	src := file.src[file.fSet.Position(node.Pos()).Offset:file.fSet.Position(node.End()).Offset]
+
+	var s scanner.Scanner
+	s.Init(token.NewFileSet().AddFile("", -1, len(src)), src, nil, 0)
+
+	var buf strings.Builder
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+
+		if lit == "" {
+			lit = tok.String()
+		}
+		buf.WriteString(lit)
+		buf.WriteByte(' ')
+	}
+
+	return fingerprint(buf.String())
+}
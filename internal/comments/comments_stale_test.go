@@ -0,0 +1,244 @@
+package comments
+
+import (
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newTestFile parses src written to a.go in dir.
+func newTestFile(t *testing.T, dir, src string) *file {
+	t.Helper()
+
+	path := filepath.Join(dir, "a.go")
+	writeTestFile(t, path, src)
+
+	file, err := newFile(path, []byte(src), NewConfigCache("", nil), Options{})
+	if err != nil {
+		t.Fatalf("newFile() error = %v", err)
+	}
+	return file
+}
+
+func TestNodeFingerprint(t *testing.T) {
+	const base = "package a\n\ntype T struct {\n\tA int\n\tB string\n}\n"
+
+	tests := []struct {
+		name string
+		src  string
+		same bool
+	}{
+		{
+			name: "same source",
+			src:  base,
+			same: true,
+		},
+		{
+			name: "comments and layout",
+			src:  "package a\n\ntype T struct {\n\t// A is a.\n\tA   int // a\n\n\tB string\n}\n",
+			same: true,
+		},
+		{
+			name: "field type",
+			src:  "package a\n\ntype T struct {\n\tA int64\n\tB string\n}\n",
+		},
+		{
+			name: "field added",
+			src:  "package a\n\ntype T struct {\n\tA int\n\tB string\n\tC bool\n}\n",
+		},
+	}
+
+	dir := testModule(t, "")
+	want := typeFingerprint(t, newTestFile(t, dir, base))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := typeFingerprint(t, newTestFile(t, dir, tt.src))
+			if (got == want) != tt.same {
+				t.Errorf("nodeFingerprint() = %s, base %s, want same %v", got, want, tt.same)
+			}
+		})
+	}
+}
+
+// typeFingerprint returns the fingerprint of the first type of the file.
+func typeFingerprint(t *testing.T, file *file) string {
+	t.Helper()
+
+	for _, decl := range file.f.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
+			return file.nodeFingerprint(genDecl.Specs[0])
+		}
+	}
+	t.Fatal("no type declaration")
+	return ""
+}
+
+func TestFuncFingerprint(t *testing.T) {
+	const base = "package a\n\nfunc Foo(x int) error {\n\tif x < 0 {\n\t\treturn ErrNegative\n\t}\n\treturn nil\n}\n"
+
+	tests := []struct {
+		name string
+		src  string
+		same bool
+	}{
+		{
+			name: "same source",
+			src:  base,
+			same: true,
+		},
+		{
+			name: "body without new fact",
+			src:  "package a\n\nfunc Foo(x int) error {\n\tif x < 0 {\n\t\treturn ErrNegative\n\t}\n\tx++\n\treturn nil\n}\n",
+			same: true,
+		},
+		{
+			name: "signature",
+			src:  "package a\n\nfunc Foo(x int64) error {\n\tif x < 0 {\n\t\treturn ErrNegative\n\t}\n\treturn nil\n}\n",
+		},
+		{
+			name: "sentinel removed",
+			src:  "package a\n\nfunc Foo(x int) error {\n\treturn nil\n}\n",
+		},
+		{
+			name: "panic added",
+			src:  "package a\n\nfunc Foo(x int) error {\n\tif x < 0 {\n\t\treturn ErrNegative\n\t}\n\tpanic(x)\n}\n",
+		},
+	}
+
+	dir := testModule(t, "")
+	want := funcFingerprint(firstFunc(t, newTestFile(t, dir, base)))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := funcFingerprint(firstFunc(t, newTestFile(t, dir, tt.src)))
+			if (got == want) != tt.same {
+				t.Errorf("funcFingerprint() = %s, base %s, want same %v", got, want, tt.same)
+			}
+		})
+	}
+}
+
+// firstFunc returns the first function of the file.
+func firstFunc(t *testing.T, file *file) *ast.FuncDecl {
+	t.Helper()
+
+	for _, decl := range file.f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			return fn
+		}
+	}
+	t.Fatal("no function")
+	return nil
+}
+
+func TestCheckStale(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "up to date",
+			src: `package a
+
+// Foo is a function.
+// It takes x of type int.
+//
+// Author: Bot #5ed9a0e4.
+func Foo(x int) {}
+`,
+		},
+		{
+			name: "signature changed",
+			src: `package a
+
+// Foo is a function.
+// It takes x of type int.
+//
+// Author: Bot #5ed9a0e4.
+func Foo(x, y int) {}
+`,
+			want: []string{"a.go:7:1: stale comment on func Foo"},
+		},
+		{
+			name: "grouped declaration",
+			src: `package a
+
+const (
+	// A is a constant.
+	//
+	// Author: Bot #00000000.
+	A = 1
+)
+`,
+			want: []string{"a.go:7:2: stale comment on const A"},
+		},
+		{
+			name: "errors changed",
+			src: `package a
+
+// Foo is a function.
+// It returns an error if it fails.
+//
+// Author: Bot #ddb8fe84.
+func Foo() error {
+	return ErrClosed
+}
+`,
+			want: []string{"a.go:7:1: stale comment on func Foo"},
+		},
+		{
+			name: "signed before the fingerprints",
+			src: `package a
+
+// Foo is a function.
+//
+// Author: Bot.
+func Foo(x, y int) {}
+`,
+		},
+		{
+			name: "human comment",
+			src: `package a
+
+// Foo is written by a human.
+func Foo(x, y int) {}
+`,
+		},
+		{
+			name: "other signature",
+			src: `package a
+
+// Foo is a function.
+//
+// Author: Other #00000000.
+func Foo(x, y int) {}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, "signature: \"Bot\"\n")
+			path := filepath.Join(dir, "a.go")
+			writeTestFile(t, path, tt.src)
+
+			findings, err := CheckStale(path, []byte(tt.src), NewConfigCache("", nil))
+			if err != nil {
+				t.Fatalf("CheckStale() error = %v", err)
+			}
+
+			var got []string
+			for _, finding := range findings {
+				finding.Position.Filename = filepath.Base(finding.Position.Filename)
+				got = append(got, finding.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckStale() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package comments
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// Suggestion is a finding of the check mode with the comment fixing it.
+type Suggestion struct {
+	Finding
+	// Text replaces the bytes of the source between the Start and End
+	// offsets: the comment lines inserted above the declaration, or the
+	// stale comment replaced. It is empty when no comment was generated.
+	Start int
+	End   int
+	Text  string
+}
+
+// TypedFile is the syntax tree and the type information of a file checked by
+// the caller, like a go/analysis pass, to comment it in the type-checked mode
+// without loading its package again.
+type TypedFile struct {
+	Fset *token.FileSet
+	File *ast.File
+	Pkg  *types.Package
+	Info *types.Info
+	// ModulePath is the path of the module of the package, whose interfaces
+	// are looked for in the implements sentences, or empty if unknown.
+	ModulePath string
+}
+
+// Suggest returns the findings of Check on the given Go source file with the
+// comments fixing them, generated like with Process: the comments of the
+// exported declarations without one, and the new comments of the stale ones
+// whatever the update-comments option. The source is not modified. When
+// typed is not nil, its syntax tree and types are used instead of parsing
+// src, provided they were read from the same source.
+func Suggest(ctx context.Context, fileName string, src []byte, cache *CommentConfigCache, opts Options, typed *TypedFile) ([]Suggestion, error) {
+	file, err := newFile(fileName, src, cache, opts)
+	if err != nil || file == nil {
+		return nil, err
+	}
+
+	if typed != nil && typed.Fset.File(typed.File.Pos()).Size() == len(src) {
+		file.f, file.fSet = typed.File, typed.Fset
+		file.types = &typesInfo{
+			pkg:        typed.Pkg,
+			info:       typed.Info,
+			interfaces: importedInterfaces(typed.Pkg, typed.ModulePath, file.cfg.Interfaces),
+		}
+	}
+
+	file.processor, err = newProviderChain(file.cfg, file.types, opts)
+	if err != nil {
+		return nil, err
+	}
+	file.report = opts.Report
+	file.check = true
+	file.suggest = true
+
+	if _, err := file.autoComment(ctx); err != nil {
+		return nil, err
+	}
+
+	edits := make(map[int]edit, len(file.edits))
+	for _, e := range file.edits {
+		edits[file.fSet.Position(e.pos).Offset] = e
+	}
+
+	suggestions := make([]Suggestion, len(file.findings))
+	for i, finding := range file.findings {
+		suggestions[i].Finding = finding
+		if e, ok := edits[finding.Position.Offset]; ok {
+			suggestions[i].Start = e.start
+			suggestions[i].End = e.end
+			suggestions[i].Text = e.text
+		}
+	}
+	return suggestions, nil
+}
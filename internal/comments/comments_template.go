@@ -0,0 +1,236 @@
+package comments
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode"
+
+	"github.com/stoewer/go-strcase"
+)
+
+// templatesFS holds the default templates of the comments of the default
+// provider, one file per kind of declaration, plus common.tmpl defining the
+// blocks they share.
+//
+//go:embed templates/*.tmpl
+var templatesFS embed.FS
+
+// templateFuncs are the functions available in the comment templates and in
+// the prompt templates.
+var templateFuncs = template.FuncMap{
+	"join":             strings.Join,
+	"joinWords":        joinWords,
+	"joinAlternatives": joinAlternatives,
+	"sep":              enumSep,
+	"article":          indefiniteArticle,
+	"withArticle":      withArticle,
+	"pluralize":        pluralize,
+	"humanize":         humanizeIdentifier,
+}
+
+// defaultTemplates are the parsed embedded templates.
+var defaultTemplates = template.Must(template.New("").Funcs(templateFuncs).ParseFS(templatesFS, "templates/*.tmpl"))
+
+var (
+	commentTemplatesMu sync.Mutex
+	// commentTemplates are the templates loaded from each templates
+	// directory, so that a directory is parsed once for all the files.
+	commentTemplates = make(map[string]*template.Template)
+)
+
+// loadTemplates returns the default templates overridden by the *.tmpl files
+// of dir. A file replaces the default file with the same name, and the
+// blocks it defines replace the default ones, like "signature". The default
+// templates are returned when dir is empty.
+func loadTemplates(dir string) (*template.Template, error) {
+	if dir == "" {
+		return defaultTemplates, nil
+	}
+
+	commentTemplatesMu.Lock()
+	defer commentTemplatesMu.Unlock()
+
+	if tmpl, ok := commentTemplates[dir]; ok {
+		return tmpl, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	tmpl, err := defaultTemplates.Clone()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tmpl.New(filepath.Base(path)).Parse(string(src)); err != nil {
+			return nil, err
+		}
+	}
+
+	commentTemplates[dir] = tmpl
+	return tmpl, nil
+}
+
+// renderTemplate executes the first template found in names with data. The
+// trailing spaces of the lines and the leading and trailing empty lines are
+// removed.
+func renderTemplate(tmpl *template.Template, data any, names ...string) (string, error) {
+	for _, name := range names {
+		t := tmpl.Lookup(name)
+		if t == nil {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return "", err
+		}
+
+		lines := strings.Split(buf.String(), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+		}
+		return strings.Trim(strings.Join(lines, "\n"), "\n"), nil
+	}
+	return "", fmt.Errorf("no %s template", names[0])
+}
+
+// initialisms are the words written in upper case by humanizeIdentifier.
+var initialisms = map[string]bool{
+	"acl": true, "api": true, "ascii": true, "cpu": true, "css": true,
+	"dns": true, "eof": true, "grpc": true, "guid": true, "html": true,
+	"http": true, "https": true, "id": true, "ip": true, "json": true,
+	"jwt": true, "os": true, "rpc": true, "sql": true, "ssh": true,
+	"tcp": true, "tls": true, "ttl": true, "udp": true, "ui": true,
+	"uid": true, "uri": true, "url": true, "utf8": true, "uuid": true,
+	"vm": true, "xml": true, "yaml": true,
+}
+
+// humanizeIdentifier converts a Go identifier like "MaxRetryCount" in words
+// like "max retry count", keeping the initialisms like "user ID" or "HTTP
+// client" in upper case.
+func humanizeIdentifier(name string) string {
+	words := strings.Fields(strings.ReplaceAll(strcase.SnakeCase(name), "_", " "))
+	for i, word := range words {
+		if initialisms[word] {
+			words[i] = strings.ToUpper(word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// pluralize returns the plural of word when count is not 1, like "methods",
+// "aliases" or "entries".
+func pluralize(word string, count int) string {
+	if count == 1 || word == "" {
+		return word
+	}
+
+	lower := strings.ToLower(word)
+	switch {
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return word + "es"
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return word[:len(word)-1] + "ies"
+	default:
+		return word + "s"
+	}
+}
+
+// anWords are the words starting with a consonant letter but a vowel sound.
+var anWords = []string{"hour", "honest", "honor", "heir"}
+
+// aWords are the words starting with a vowel letter but a consonant sound.
+var aWords = []string{"uni", "usa", "use", "usi", "usu", "uti", "uint", "one", "once", "euro"}
+
+// indefiniteArticle returns the indefinite article of word, "a" or "an",
+// from the sound of its first letter. The initialisms like "URL" or "HTTP"
+// are spelled letter by letter.
+func indefiniteArticle(word string) string {
+	word = strings.TrimLeft(word, "*[]&")
+	if word == "" {
+		return "a"
+	}
+
+	first, _, _ := strings.Cut(word, " ")
+	if len(first) > 1 && strings.ToUpper(first) == first && initialisms[strings.ToLower(first)] {
+		if strings.ContainsRune("AEFHILMNORSX", rune(first[0])) {
+			return "an"
+		}
+		return "a"
+	}
+
+	lower := strings.ToLower(word)
+	for _, prefix := range anWords {
+		if strings.HasPrefix(lower, prefix) {
+			return "an"
+		}
+	}
+	for _, prefix := range aWords {
+		if strings.HasPrefix(lower, prefix) {
+			return "a"
+		}
+	}
+	if strings.ContainsRune("aeiou", rune(lower[0])) {
+		return "an"
+	}
+	return "a"
+}
+
+// withArticle prefixes words with their indefinite article.
+func withArticle(words string) string {
+	return indefiniteArticle(words) + " " + words
+}
+
+// enumSep returns the separator written before the item i of an enumeration
+// of n items: nothing before the first one, "and" before the last one and a
+// comma before the other ones.
+func enumSep(i, n int) string {
+	switch {
+	case i == 0:
+		return ""
+	case i == n-1:
+		return " and "
+	default:
+		return ", "
+	}
+}
+
+// joinWords joins words in an English enumeration like "a, b and c".
+func joinWords(words []string) string {
+	return joinWordsWith(words, "and")
+}
+
+// joinAlternatives joins words in an English alternative like "a, b or c".
+func joinAlternatives(words []string) string {
+	return joinWordsWith(words, "or")
+}
+
+func joinWordsWith(words []string, conjunction string) string {
+	switch len(words) {
+	case 0:
+		return ""
+	case 1:
+		return words[0]
+	default:
+		return strings.Join(words[:len(words)-1], ", ") + " " + conjunction + " " + words[len(words)-1]
+	}
+}
@@ -0,0 +1,201 @@
+package comments
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestHumanizeIdentifier(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Name", want: "name"},
+		{name: "MaxRetryCount", want: "max retry count"},
+		{name: "userID", want: "user ID"},
+		{name: "HTTPClient", want: "HTTP client"},
+		{name: "parseURL", want: "parse URL"},
+		{name: "max_size", want: "max size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := humanizeIdentifier(tt.name); got != tt.want {
+				t.Errorf("humanizeIdentifier() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPluralize(t *testing.T) {
+	tests := []struct {
+		word  string
+		count int
+		want  string
+	}{
+		{word: "method", count: 1, want: "method"},
+		{word: "method", count: 0, want: "methods"},
+		{word: "method", count: 2, want: "methods"},
+		{word: "alias", count: 2, want: "aliases"},
+		{word: "box", count: 2, want: "boxes"},
+		{word: "match", count: 2, want: "matches"},
+		{word: "entry", count: 2, want: "entries"},
+		{word: "key", count: 2, want: "keys"},
+		{word: "", count: 2, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := pluralize(tt.word, tt.count); got != tt.want {
+				t.Errorf("pluralize(%q, %d) = %q, want %q", tt.word, tt.count, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndefiniteArticle(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{word: "string", want: "a"},
+		{word: "int", want: "an"},
+		{word: "*Store", want: "a"},
+		{word: "[]error", want: "an"},
+		{word: "uint64", want: "a"},
+		{word: "unexported constant", want: "an"},
+		{word: "user", want: "a"},
+		{word: "hour", want: "an"},
+		{word: "URL", want: "a"},
+		{word: "HTTP client", want: "an"},
+		{word: "SQL query", want: "an"},
+		{word: "", want: "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := indefiniteArticle(tt.word); got != tt.want {
+				t.Errorf("indefiniteArticle(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+
+	if got, want := withArticle("error"), "an error"; got != want {
+		t.Errorf("withArticle() = %q, want %q", got, want)
+	}
+}
+
+func TestJoinWords(t *testing.T) {
+	tests := []struct {
+		words   []string
+		want    string
+		wantAlt string
+	}{
+		{},
+		{words: []string{"a"}, want: "a", wantAlt: "a"},
+		{words: []string{"a", "b"}, want: "a and b", wantAlt: "a or b"},
+		{words: []string{"a", "b", "c"}, want: "a, b and c", wantAlt: "a, b or c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := joinWords(tt.words); got != tt.want {
+				t.Errorf("joinWords() = %q, want %q", got, tt.want)
+			}
+			if got := joinAlternatives(tt.words); got != tt.wantAlt {
+				t.Errorf("joinAlternatives() = %q, want %q", got, tt.wantAlt)
+			}
+
+			var sep string
+			for i, word := range tt.words {
+				sep += enumSep(i, len(tt.words)) + word
+			}
+			if sep != tt.want {
+				t.Errorf("enumSep() enumeration = %q, want %q", sep, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "const.tmpl"), "{{.Name}} is a {{humanize .Name}} value.")
+	writeTestFile(t, filepath.Join(dir, "override.tmpl"), `{{define "param"}}{{.Name}} ({{.Type}}){{end}}`)
+	invalid := t.TempDir()
+	writeTestFile(t, filepath.Join(invalid, "func.tmpl"), "{{.Name")
+
+	type param struct{ Name, Type string }
+	tests := []struct {
+		name    string
+		dir     string
+		tmpl    []string
+		data    any
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "default",
+			tmpl: []string{"const.tmpl"},
+			data: map[string]string{"Name": "MaxSize", "Private": "", "Type": "int", "Description": ""},
+			want: "MaxSize is a constant of type int.",
+		},
+		{
+			name: "replaced file",
+			dir:  dir,
+			tmpl: []string{"const.tmpl"},
+			data: map[string]string{"Name": "MaxSize"},
+			want: "MaxSize is a max size value.",
+		},
+		{
+			name: "replaced block",
+			dir:  dir,
+			tmpl: []string{"param"},
+			data: param{Name: "key", Type: "string"},
+			want: "key (string)",
+		},
+		{
+			name: "default block",
+			tmpl: []string{"param"},
+			data: param{Name: "key", Type: "string"},
+			want: "key of type string",
+		},
+		{
+			name: "first found",
+			dir:  dir,
+			tmpl: []string{"missing.tmpl", "const.tmpl"},
+			data: map[string]string{"Name": "Size"},
+			want: "Size is a size value.",
+		},
+		{
+			name:    "no template",
+			tmpl:    []string{"missing.tmpl"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid template",
+			dir:     invalid,
+			wantErr: true,
+		},
+		{
+			name:    "missing directory",
+			dir:     filepath.Join(dir, "missing"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := loadTemplates(tt.dir)
+			if err == nil {
+				var got string
+				got, err = renderTemplate(tmpl, tt.data, tt.tmpl...)
+				if err == nil && got != tt.want {
+					t.Errorf("renderTemplate() = %q, want %q", got, tt.want)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,568 @@
+package comments
+
+import (
+	"context"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testModule writes a module holding a .gocomments file with the given
+// configuration in a temporary directory and returns its path.
+func testModule(t *testing.T, config string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "go.mod"), "module example.com/test\n\ngo 1.22\n")
+	if config != "" {
+		writeTestFile(t, filepath.Join(dir, ".gocomments"), config)
+	}
+	return dir
+}
+
+// writeTestFile writes content to the file at path.
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// processTest writes src to a.go in dir and returns the result of Process.
+func processTest(t *testing.T, dir, src string) string {
+	t.Helper()
+	return processTestOptions(t, dir, src, Options{})
+}
+
+// processTestOptions is processTest with the given options.
+func processTestOptions(t *testing.T, dir, src string, opts Options) string {
+	t.Helper()
+
+	path := filepath.Join(dir, "a.go")
+	writeTestFile(t, path, src)
+
+	out, err := Process(context.Background(), path, []byte(src), NewConfigCache("", nil), opts)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	return string(out)
+}
+
+func TestProcessKeepsTheSource(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "comments kept",
+			src: `package a
+
+// Floating comment kept.
+
+/* Block comment kept. */
+func Foo() {
+	// Inline comment kept.
+}
+`,
+			want: `package a
+
+// Floating comment kept.
+
+/* Block comment kept. */
+func Foo() {
+	// Inline comment kept.
+}
+`,
+		},
+		{
+			name: "declaration not starting its line",
+			src: `package a
+
+var a, b = 1, 2; var c int
+`,
+			want: `package a
+
+// a is a private variable.
+// b is a private variable.
+//
+// Author: Bot #432fc9fb.
+var a, b = 1, 2; var c int
+`,
+		},
+		{
+			name: "directives kept above the declaration",
+			src: `package a
+
+//nolint:errcheck
+//go:noinline
+func Bar(x int) {}
+`,
+			want: `package a
+
+// Bar is a function.
+// It takes x of type int.
+//
+// Author: Bot #1b49bf4d.
+//
+//nolint:errcheck
+//go:noinline
+func Bar(x int) {}
+`,
+		},
+		{
+			name: "directive moved below the replaced comment",
+			src: `package a
+
+//go:noinline
+// Bar was commented.
+//
+// Author: Bot #00000000.
+func Bar(x int) {}
+`,
+			want: `package a
+
+// Bar is a function.
+// It takes x of type int.
+//
+// Author: Bot #1b49bf4d.
+//
+//go:noinline
+func Bar(x int) {}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, "signature: \"Bot\"\nupdate-comments: true\n")
+			if got := processTest(t, dir, tt.src); got != tt.want {
+				t.Errorf("Process() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDirective(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"//go:generate stringer -type=Kind", true},
+		{"//go:noinline", true},
+		{"//nolint", true},
+		{"//nolint:errcheck", true},
+		{"//export Name", true},
+		{"//line a.go:10", true},
+		{"// go:noinline", false},
+		{"// Foo is a function.", false},
+		{"//nolinter", false},
+	}
+
+	for _, tt := range tests {
+		if got := isDirective(tt.line); got != tt.want {
+			t.Errorf("isDirective(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateComments(t *testing.T) {
+	src := `package a
+
+// Old is a human comment.
+func Old(x int) {}
+
+// Foo was generated before the fingerprints.
+//
+// Author: Bot.
+func Foo(x int) {}
+
+const (
+	// A was generated.
+	//
+	// Author: Bot #00000000.
+	A = 1
+)
+
+// S is a human comment.
+type S struct {
+	// B was generated.
+	//
+	// Author: Bot #00000000.
+	B int
+}
+
+// I is a human comment.
+type I interface {
+	// Do was generated.
+	//
+	// Author: Bot #00000000.
+	Do() error
+}
+`
+
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{
+			name:   "update-comments unset",
+			config: "signature: \"Bot\"\n",
+			want:   src,
+		},
+		{
+			name:   "update-comments set",
+			config: "signature: \"Bot\"\nupdate-comments: true\n",
+			want: `package a
+
+// Old is a human comment.
+func Old(x int) {}
+
+// Foo is a function.
+// It takes x of type int.
+//
+// Author: Bot #5ed9a0e4.
+func Foo(x int) {}
+
+const (
+	// A is a constant.
+	//
+	// Author: Bot #f1fb1881.
+	A = 1
+)
+
+// S is a human comment.
+type S struct {
+	// B is the b of S, of type int.
+	//
+	// Author: Bot #3d6f064a.
+	B int
+}
+
+// I is a human comment.
+type I interface {
+	// Do is the method of the I interface.
+	// It returns an error if it fails.
+	//
+	// Author: Bot #43e70b8f.
+	Do() error
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, tt.config)
+			if got := processTest(t, dir, src); got != tt.want {
+				t.Errorf("Process() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessKeepsTheFormatting(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{
+			name: "aligned fields",
+			src: `package a
+
+// S is a struct.
+type S struct {
+	A      int
+	mu     sync.Mutex // mu guards A.
+	Longer string
+}
+`,
+		},
+		{
+			name: "aligned tags",
+			src: `package a
+
+// S is a struct.
+type S struct {
+	ID   int    ` + "`json:\"id\"`" + `
+	Name string ` + "`json:\"name\"`" + `
+}
+`,
+		},
+		{
+			name: "aligned interface methods",
+			src: `package a
+
+// I is an interface.
+type I interface {
+	Get(key string) (string, error)
+	Set(key, value string) error // Set stores value.
+}
+`,
+		},
+		{
+			name: "aligned consts",
+			src: `package a
+
+const (
+	A     = 1
+	Bcdef = 2 // Bcdef is documented.
+)
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, "signature: \"Bot\"\n")
+			got := processTest(t, dir, tt.src)
+			if got == tt.src {
+				t.Fatal("Process() added no comment")
+			}
+
+			formatted, err := format.Source([]byte(got))
+			if err != nil {
+				t.Fatalf("format.Source() error = %v", err)
+			}
+			if got != string(formatted) {
+				t.Errorf("Process() =\n%s\nwant the gofmt output\n%s", got, formatted)
+			}
+		})
+	}
+}
+
+func TestProcessComments(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "struct fields",
+			src: `package a
+
+// S is a struct.
+type S struct {
+	A int
+	N struct {
+		X int
+	}
+	c int // c is documented.
+}
+`,
+			want: `package a
+
+// S is a struct.
+type S struct {
+	// A is the a of S, of type int.
+	A int
+	// N groups the n settings of S.
+	N struct {
+		// X is the x of S.N, of type int.
+		X int
+	}
+	c int // c is documented.
+}
+`,
+		},
+		{
+			name: "interface methods",
+			src: `package a
+
+// I is an interface.
+type I interface {
+	Do() error
+	fmt.Stringer
+	~int | ~string
+}
+`,
+			want: `package a
+
+// I is an interface.
+type I interface {
+	// Do is the method of the I interface.
+	// It returns an error if it fails.
+	Do() error
+	// Stringer is embedded to add its methods to the I interface.
+	fmt.Stringer
+	~int | ~string
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, "")
+			if got := processTest(t, dir, tt.src); got != tt.want {
+				t.Errorf("Process() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateFuncCode(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{src: "func Open(name string) (*File, error)"},
+		{src: "func (s *Set[T]) Add(values ...T) (n int, err error)"},
+		{src: "func (Set[T]) Len() int", want: "func (s Set[T]) Len() int"},
+		{src: "func Map[T, U any](values []T, fn func(T) U) []U"},
+		{src: "func Sum[N ~int | ~float64](values ...N) N"},
+		{src: "func Pipe(in <-chan int, out chan<- string, done chan struct{})"},
+		{src: "func Lookup(m map[string][]*pkg.Item, key [4]byte) (item *pkg.Item, ok bool)"},
+		{src: "func Apply(pair Pair[string, int], opts ...func(*Options))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			f, err := parser.ParseFile(token.NewFileSet(), "a.go", "package a\n\n"+tt.src+" {}\n", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := tt.want
+			if want == "" {
+				want = tt.src
+			}
+			if got := GenerateFuncCode(f.Decls[0].(*ast.FuncDecl)); got != want {
+				t.Errorf("GenerateFuncCode() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestGetTypeName(t *testing.T) {
+	tests := []string{
+		"int",
+		"*pkg.Item",
+		"map[string][]*pkg.Item",
+		"[...]int",
+		"chan (<-chan int)",
+		"func(context.Context) error",
+		"struct{ A int; B string `json:\"b\"` }",
+		"interface{ Read(p []byte) (n int, err error) }",
+		"Set[T]",
+		"Pair[K, V]",
+	}
+
+	for _, want := range tests {
+		t.Run(want, func(t *testing.T) {
+			expr, err := parser.ParseExpr(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := getTypeName(expr); got != want {
+				t.Errorf("getTypeName() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestCommentConstBlock(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "iota enumeration",
+			src: `package a
+
+const (
+	Red Color = iota
+	Green
+	Blue
+)
+`,
+			want: `package a
+
+// The Color values Red, Green and Blue.
+//
+// Author: Bot #30865963.
+const (
+	Red Color = iota
+	Green
+	Blue
+)
+`,
+		},
+		{
+			name: "untyped constants",
+			src: `package a
+
+const (
+	MinSize = 1
+	// MaxSize is documented.
+	MaxSize = 10
+	limit   = 5
+)
+`,
+			want: `package a
+
+// The constants MinSize, MaxSize and limit.
+//
+// Author: Bot #8c101d74.
+const (
+	MinSize = 1
+	// MaxSize is documented.
+	MaxSize = 10
+	limit   = 5
+)
+`,
+		},
+		{
+			name: "documented block",
+			src: `package a
+
+// The sizes.
+const (
+	MinSize = 1
+	MaxSize = 10
+)
+
+// The defaults.
+var (
+	Name = "a"
+	Size = 1
+)
+`,
+		},
+		{
+			name: "documented constants",
+			src: `package a
+
+const (
+	// MinSize is documented.
+	MinSize = 1
+	// MaxSize is documented.
+	MaxSize = 10
+)
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, "signature: \"Bot\"\n")
+			want := tt.want
+			if want == "" {
+				want = tt.src
+			}
+			if got := processTest(t, dir, tt.src); got != want {
+				t.Errorf("Process() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
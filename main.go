@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,17 +10,27 @@ import (
 	"io/fs"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ariden/gocomments/internal/comments"
 )
 
+// errFindings is returned by the check commands when issues were reported.
+var errFindings = errors.New("issues found")
+
 func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
 	if err := run(); err != nil {
+		if errors.Is(err, errFindings) {
+			os.Exit(1)
+		}
+
 		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(2)
 	}
@@ -29,16 +40,40 @@ type appArgs struct {
 	local    string
 	prefixes []string
 
-	listOnly bool
-	write    bool
-	diffOnly bool
+	listOnly  bool
+	write     bool
+	diffOnly  bool
+	typeCheck bool
+	jobs      int
+	declJobs  int
+	report    string
+	noCache   bool
+	cacheDir  string
+	since     string
 }
 
 func run() error {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			return runCheck(os.Args[2:])
+		case "check-stale":
+			return runCheckStale(os.Args[2:])
+		case "coverage":
+			return runCoverage(os.Args[2:])
+		case "cache":
+			return runCache(os.Args[2:])
+		}
+	}
+
 	var args appArgs
 
 	flag.Usage = func() {
 		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "Usage: gocomments [flags] [path ...]")
+		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "       gocomments check [flags] [path ...]")
+		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "       gocomments check-stale [flags] [path ...]")
+		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "       gocomments coverage [flags] [path ...]")
+		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "       gocomments cache stats|prune [flags]")
 		flag.PrintDefaults()
 		os.Exit(2)
 	}
@@ -49,6 +84,13 @@ func run() error {
 	flag.BoolVar(&args.listOnly, "l", false, "list files whose formatting differs from goimport's")
 	flag.BoolVar(&args.write, "w", false, "write result to (source) file instead of stdout")
 	flag.BoolVar(&args.diffOnly, "d", false, "display diffs instead of rewriting files")
+	flag.BoolVar(&args.typeCheck, "types", false, "load the packages to resolve the types used by the comments")
+	flag.IntVar(&args.jobs, "j", runtime.NumCPU(), "number of files processed concurrently")
+	flag.IntVar(&args.declJobs, "decl-jobs", 2, "number of declarations per file commented concurrently by the AI providers")
+	flag.StringVar(&args.report, "report", "", "write the provider of each generated comment to this file (- for stderr)")
+	flag.StringVar(&args.since, "since", "", "only comment the declarations changed since this git revision")
+	flag.BoolVar(&args.noCache, "no-cache", false, "do not read nor write the cache of the comments of the AI providers")
+	flag.StringVar(&args.cacheDir, "cache-dir", "", "directory of the cache of the comments of the AI providers (default gocomments in the user cache directory)")
 
 	flag.Parse()
 
@@ -64,21 +106,161 @@ const (
 
 func process(args *appArgs, paths ...string) error {
 	cache := comments.NewConfigCache(args.local, args.prefixes)
+	defer comments.ClosePlugins()
+
+	opts := comments.Options{
+		Jobs: args.declJobs,
+	}
+	if args.typeCheck {
+		opts.Packages = comments.NewPackageLoader()
+	}
+	if args.report != "" {
+		opts.Report = comments.NewReport()
+	}
+	if args.since != "" {
+		if len(paths) == 0 {
+			return errors.New("can't use -since on stdin")
+		}
+		var err error
+		if opts.Changes, err = comments.GitChanges(args.since, paths); err != nil {
+			return err
+		}
+	}
+	if !args.noCache {
+		opts.Cache = comments.NewResponseCache(args.cacheDir)
+	}
+
+	err := processPaths(cache, opts, args, paths)
+	if opts.Report == nil {
+		return err
+	}
+
+	if reportErr := writeReport(opts.Report, args.report); err == nil {
+		err = reportErr
+	}
+	return err
+}
+
+// writeReport writes the report to the file at path, or to stderr for "-".
+func writeReport(report *comments.Report, path string) error {
+	if path == "-" {
+		return report.Write(os.Stderr)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := report.Write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func processPaths(cache *comments.CommentConfigCache, opts comments.Options, args *appArgs, paths []string) error {
+	// Interrupting the run cancels the pending requests to the providers.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
 	if len(paths) == 0 {
-		return processFile(cache, "<standard input>", fileSourceStdin, os.Stdin, os.Stdout, args)
+		return processFile(ctx, cache, opts, "<standard input>", fileSourceStdin, os.Stdin, os.Stdout, args)
+	}
+
+	var files []string
+	if err := walkFiles(paths, func(path string) error {
+		if opts.Changes.Contains(path) {
+			files = append(files, path)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return processFiles(ctx, files, args.jobs, os.Stdout, func(ctx context.Context, path string, out io.Writer) error {
+		return processFile(ctx, cache, opts, path, fileSourceFilepath, nil, out, args)
+	})
+}
+
+// processFiles calls fn for each file with up to jobs files processed
+// concurrently. The output of each file is buffered and written to out in
+// the order of files, so that the output does not depend on the scheduling.
+// The first error in this order stops the processing of the next files.
+func processFiles(ctx context.Context, files []string, jobs int, out io.Writer, fn func(ctx context.Context, path string, out io.Writer) error) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	type result struct {
+		out  bytes.Buffer
+		err  error
+		done chan struct{}
+	}
+
+	results := make([]*result, len(files))
+	for i := range results {
+		results[i] = &result{done: make(chan struct{})}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for i := range files {
+			indexes <- i
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				r := results[i]
+				if r.err = ctx.Err(); r.err == nil {
+					r.err = fn(ctx, files[i], &r.out)
+				}
+				close(r.done)
+			}
+		}()
 	}
+	defer func() {
+		// Skip the files not processed yet after an error.
+		cancel()
+		wg.Wait()
+	}()
 
+	for _, r := range results {
+		<-r.done
+		if r.err != nil {
+			return r.err
+		}
+		if _, err := out.Write(r.out.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkFiles calls fn for each Go file of the given paths, walking the
+// directories recursively.
+func walkFiles(paths []string, fn func(path string) error) error {
 	for _, path := range paths {
 		switch dir, err := os.Stat(path); {
 		case err != nil:
 			return err
 		case dir.IsDir():
-			return filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
-				return visitFile(cache, args, path, d, err)
-			})
+			if err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+				return visitFile(path, d, err, fn)
+			}); err != nil {
+				return err
+			}
 		default:
-			if err := processFile(cache, path, fileSourceFilepath, nil, os.Stdout, args); err != nil {
+			if err := fn(path); err != nil {
 				return err
 			}
 		}
@@ -87,7 +269,7 @@ func process(args *appArgs, paths ...string) error {
 	return nil
 }
 
-func processFile(cache *comments.CommentConfigCache, filename string, source fileSource, in io.Reader, out io.Writer, args *appArgs) error {
+func processFile(ctx context.Context, cache *comments.CommentConfigCache, opts comments.Options, filename string, source fileSource, in io.Reader, out io.Writer, args *appArgs) error {
 	if in == nil {
 		f, err := os.Open(filename)
 		if err != nil {
@@ -106,7 +288,7 @@ func processFile(cache *comments.CommentConfigCache, filename string, source fil
 		return err
 	}
 
-	res, err := comments.Process(filename, src, cache)
+	res, err := comments.Process(ctx, filename, src, cache, opts)
 	if err != nil {
 		return err
 	}
@@ -145,7 +327,7 @@ func processFile(cache *comments.CommentConfigCache, filename string, source fil
 	return nil
 }
 
-func visitFile(cache *comments.CommentConfigCache, args *appArgs, path string, d fs.DirEntry, err error) error {
+func visitFile(path string, d fs.DirEntry, err error, fn func(path string) error) error {
 	if err != nil {
 		return err
 	}
@@ -164,7 +346,296 @@ func visitFile(cache *comments.CommentConfigCache, args *appArgs, path string, d
 		return nil
 	}
 
-	return processFile(cache, path, fileSourceFilepath, nil, os.Stdout, args)
+	return fn(path)
+}
+
+// runCheck reports the exported declarations without doc comment and the
+// stale generated comments, without modifying the files. It fails with
+// errFindings if there are more findings than the threshold.
+func runCheck(arguments []string) error {
+	var (
+		args      appArgs
+		format    string
+		output    string
+		threshold int
+	)
+
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gocomments check [flags] [path ...]")
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&args.local, "local", "", "put imports beginning with this string after 3rd-party package")
+	flags.Var((*comments.ArrayStringFlag)(&args.prefixes), "prefix", "relative local prefix to from a new import group (can be given several times)")
+	flags.StringVar(&format, "format", comments.FormatText, "output format: text, json or sarif")
+	flags.StringVar(&output, "o", "-", "write the findings to this file (- for stdout)")
+	flags.IntVar(&threshold, "threshold", 0, "exit with status 1 when there are more findings than this number")
+
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+
+	switch format {
+	case comments.FormatText, comments.FormatJSON, comments.FormatSARIF:
+	default:
+		return fmt.Errorf("unknown format %q, expecting text, json or sarif", format)
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	cache := comments.NewConfigCache(args.local, args.prefixes)
+
+	var findings []comments.Finding
+	err := walkFiles(paths, func(path string) error {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		fileFindings, err := comments.Check(path, src, cache)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, fileFindings...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if output == "-" {
+		err = comments.WriteFindings(os.Stdout, format, findings)
+	} else {
+		err = writeFindingsFile(output, format, findings)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(findings) > threshold {
+		return errFindings
+	}
+	return nil
+}
+
+// writeFindingsFile writes the findings to the file at path.
+func writeFindingsFile(path, format string, findings []comments.Finding) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := comments.WriteFindings(f, format, findings); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runCheckStale lists the generated comments whose declaration changed since
+// they were written. It fails with errFindings if there is at least one.
+func runCheckStale(arguments []string) error {
+	var args appArgs
+
+	flags := flag.NewFlagSet("check-stale", flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gocomments check-stale [flags] [path ...]")
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&args.local, "local", "", "put imports beginning with this string after 3rd-party package")
+	flags.Var((*comments.ArrayStringFlag)(&args.prefixes), "prefix", "relative local prefix to from a new import group (can be given several times)")
+
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	cache := comments.NewConfigCache(args.local, args.prefixes)
+
+	var found bool
+	err := walkFiles(paths, func(path string) error {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		stale, err := comments.CheckStale(path, src, cache)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range stale {
+			found = true
+			_, _ = fmt.Fprintln(os.Stdout, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if found {
+		return errFindings
+	}
+	return nil
+}
+
+// runCoverage reports the percentage of documented exported declarations
+// of each package. It fails with errFindings if a package is below the
+// min-coverage of its configuration.
+func runCoverage(arguments []string) error {
+	var (
+		args   appArgs
+		format string
+		output string
+	)
+
+	flags := flag.NewFlagSet("coverage", flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gocomments coverage [flags] [path ...]")
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&args.local, "local", "", "put imports beginning with this string after 3rd-party package")
+	flags.Var((*comments.ArrayStringFlag)(&args.prefixes), "prefix", "relative local prefix to from a new import group (can be given several times)")
+	flags.StringVar(&format, "format", comments.FormatTable, "output format: table, json or html")
+	flags.StringVar(&output, "o", "-", "write the report to this file (- for stdout)")
+
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+
+	switch format {
+	case comments.FormatTable, comments.FormatJSON, comments.FormatHTML:
+	default:
+		return fmt.Errorf("unknown format %q, expecting table, json or html", format)
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	cache := comments.NewConfigCache(args.local, args.prefixes)
+
+	report := comments.NewCoverageReport()
+	err := walkFiles(paths, func(path string) error {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return report.AddFile(path, src, cache)
+	})
+	if err != nil {
+		return err
+	}
+
+	if output == "-" {
+		err = report.Write(os.Stdout, format)
+	} else {
+		err = writeCoverageFile(output, format, report)
+	}
+	if err != nil {
+		return err
+	}
+
+	var failed bool
+	for _, pkg := range report.Packages() {
+		if pkg.BelowMin() {
+			failed = true
+			_, _ = fmt.Fprintf(os.Stderr, "%s: coverage %.1f%% is below the min-coverage %.1f%%\n", pkg.Dir, pkg.Total.Percent(), *pkg.MinCoverage)
+		}
+	}
+	if failed {
+		return errFindings
+	}
+	return nil
+}
+
+// writeCoverageFile writes the coverage report to the file at path.
+func writeCoverageFile(path, format string, report *comments.CoverageReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := report.Write(f, format); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// openCache opens the cache of the comments in dir, or in the user cache
+// directory when dir is empty.
+func openCache(dir string) (*comments.ResponseCache, error) {
+	if dir == "" {
+		var err error
+		if dir, err = comments.DefaultCacheDir(); err != nil {
+			return nil, err
+		}
+	}
+	return comments.OpenResponseCache(dir)
+}
+
+// runCache prints the statistics of the cache of the comments, or removes
+// its entries not used recently.
+func runCache(arguments []string) error {
+	var (
+		cacheDir  string
+		olderThan time.Duration
+	)
+
+	flags := flag.NewFlagSet("cache", flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gocomments cache stats [flags]")
+		_, _ = fmt.Fprintln(flags.Output(), "       gocomments cache prune [flags]")
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&cacheDir, "cache-dir", "", "directory of the cache (default gocomments in the user cache directory)")
+	flags.DurationVar(&olderThan, "older-than", 30*24*time.Hour, "prune the entries not used for this duration, 0 for all of them")
+
+	if len(arguments) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	command := arguments[0]
+	if err := flags.Parse(arguments[1:]); err != nil {
+		return err
+	}
+
+	cache, err := openCache(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "stats":
+		stats, err := cache.Stats()
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprint(os.Stdout, stats)
+	case "prune":
+		removed, freed, err := cache.Prune(olderThan)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(os.Stdout, "%d entries removed, %d bytes freed\n", removed, freed)
+	default:
+		return fmt.Errorf("unknown cache command %q, expecting stats or prune", command)
+	}
+	return nil
 }
 
 func diff(b1, b2 []byte, filename string) ([]byte, error) {
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProcessFiles(t *testing.T) {
+	files := []string{"a.go", "b.go", "c.go", "d.go", "e.go", "f.go"}
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name    string
+		jobs    int
+		fail    string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "sequential",
+			jobs: 1,
+			want: "a.go\nb.go\nc.go\nd.go\ne.go\nf.go\n",
+		},
+		{
+			name: "concurrent",
+			jobs: 4,
+			want: "a.go\nb.go\nc.go\nd.go\ne.go\nf.go\n",
+		},
+		{
+			name: "invalid jobs",
+			jobs: 0,
+			want: "a.go\nb.go\nc.go\nd.go\ne.go\nf.go\n",
+		},
+		{
+			name:    "first error",
+			jobs:    4,
+			fail:    "c.go",
+			want:    "a.go\nb.go\n",
+			wantErr: errFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var running, maxRunning atomic.Int32
+
+			var out bytes.Buffer
+			err := processFiles(context.Background(), files, tt.jobs, &out, func(ctx context.Context, path string, w io.Writer) error {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					m := maxRunning.Load()
+					if n <= m || maxRunning.CompareAndSwap(m, n) {
+						break
+					}
+				}
+
+				// The first files end last, to check the ordering.
+				time.Sleep(time.Duration(len(files)-int(path[0]-'a')) * time.Millisecond)
+				if path == tt.fail {
+					return errFailed
+				}
+				_, err := fmt.Fprintln(w, path)
+				return err
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("processFiles() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("processFiles() output = %q, want %q", got, tt.want)
+			}
+			if jobs := max(tt.jobs, 1); int(maxRunning.Load()) > jobs {
+				t.Errorf("%d files processed concurrently, want at most %d", maxRunning.Load(), jobs)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+// Package provider defines the interface of the comment generators used by
+// gocomments, so that other generators can be plugged in without changing
+// the tool itself.
+//
+// A provider receives the descriptors of the undocumented declarations of a
+// file in a single batch, and returns a structured comment for each of them.
+package provider
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Version is the version of the Provider interface and of the Decl and
+// Comment types. It is increased on every incompatible change.
+const Version = 1
+
+// Kind is the kind of a commented declaration.
+type Kind string
+
+const (
+	// KindFunc is a function.
+	KindFunc Kind = "func"
+	// KindMethod is a method of a named type.
+	KindMethod Kind = "method"
+	// KindType is a type declaration.
+	KindType Kind = "type"
+	// KindConst is a constant.
+	KindConst Kind = "const"
+	// KindVar is a package variable.
+	KindVar Kind = "var"
+	// KindField is a field of a struct.
+	KindField Kind = "field"
+	// KindInterfaceMethod is a method or an embedded interface of an interface.
+	KindInterfaceMethod Kind = "interface-method"
+)
+
+// Field is a named and typed element of a declaration, like a parameter or
+// a result of a function.
+type Field struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+}
+
+// Decl describes a declaration to comment.
+type Decl struct {
+	Kind Kind   `json:"kind"`
+	Name string `json:"name"`
+	// Parent is the type owning a method, a field or an interface method.
+	// The fields of the anonymous nested structs have a dotted parent, like
+	// "Config.Server".
+	Parent string `json:"parent,omitempty"`
+	// ParentKind is the kind of the type owning a method, like "struct",
+	// "map" or "interface", or "type" when it is not known.
+	ParentKind string `json:"parent_kind,omitempty"`
+	Exported   bool   `json:"exported"`
+	// Package is the name of the package of the declaration.
+	Package string `json:"package"`
+	// File is the path of the file of the declaration.
+	File string `json:"file"`
+	// Signature is the declaration as written in Go, without its body or
+	// its fields, like "func (s *Set[T]) Add(values ...T) int".
+	Signature string `json:"signature"`
+	// Type is the type of a constant, a variable or a field, or the type
+	// a type declaration defines.
+	Type    string  `json:"type,omitempty"`
+	Params  []Field `json:"params,omitempty"`
+	Results []Field `json:"results,omitempty"`
+	// Context is the Go source of the types used by the declaration, only
+	// resolved in the type-checked mode.
+	Context string `json:"context,omitempty"`
+	// Errors are the sentences describing the errors returned and the
+	// panics found by the static analysis of a function body.
+	Errors []string `json:"errors,omitempty"`
+	// Effects are the sentences describing the side effects and the
+	// concurrency found by the static analysis of a function body.
+	Effects []string `json:"effects,omitempty"`
+	// Body is the Go source of the body of a function, braces included.
+	Body string `json:"body,omitempty"`
+	// Prompt is the prompt of the AI models, rendered from the prompt
+	// template of the configuration for the kind of the declaration. It is
+	// empty for the kinds without template.
+	Prompt string `json:"prompt,omitempty"`
+	// Node is the syntax tree of the declaration: a *ast.FuncDecl, a
+	// *ast.TypeSpec, a *ast.ValueSpec, a *ast.Field, or a *ast.GenDecl for
+	// a block of constants commented at once, whose Name lists the names.
+	// It is only set for the providers running in the gocomments process.
+	Node ast.Node `json:"-"`
+}
+
+// ParamDoc is the description of a parameter.
+type ParamDoc struct {
+	Name string `json:"name"`
+	Doc  string `json:"doc"`
+}
+
+// Comment is the doc comment generated for a declaration. The texts are
+// not prefixed with "//", the comment lines are written by gocomments.
+type Comment struct {
+	// Summary is the first sentence of the comment, starting with the name
+	// of the declaration.
+	Summary string `json:"summary"`
+	// Details are the following lines of the comment. Empty lines separate
+	// the paragraphs.
+	Details []string   `json:"details,omitempty"`
+	Params  []ParamDoc `json:"params,omitempty"`
+	Returns []string   `json:"returns,omitempty"`
+}
+
+// IsZero tells whether the comment is empty, meaning that the provider has
+// no comment for the declaration.
+func (c Comment) IsZero() bool {
+	return strings.TrimSpace(c.Text()) == ""
+}
+
+// Text returns the lines of the comment, without the "//" prefixes.
+func (c Comment) Text() string {
+	lines := append([]string{c.Summary}, c.Details...)
+
+	if len(c.Params) > 0 {
+		lines = append(lines, "", "Parameters:")
+		for _, param := range c.Params {
+			lines = append(lines, "  - "+param.Name+": "+param.Doc)
+		}
+	}
+
+	if len(c.Returns) > 0 {
+		lines = append(lines, "", "Returns:")
+		for _, ret := range c.Returns {
+			lines = append(lines, "  - "+ret)
+		}
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// Provider generates the doc comments of declarations.
+type Provider interface {
+	// Name returns the name of the provider, used to select it in the
+	// configuration.
+	Name() string
+	// Comment returns the comments of decls, in the same order. A zero
+	// Comment leaves its declaration undocumented.
+	Comment(ctx context.Context, decls []Decl) ([]Comment, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]Provider)
+)
+
+// Register makes a provider available by its name. It panics if a provider
+// with the same name is already registered, like the database/sql drivers.
+func Register(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	name := p.Name()
+	if _, ok := providers[name]; ok {
+		panic(fmt.Sprintf("provider: Register called twice for provider %s", name))
+	}
+	providers[name] = p
+}
+
+// Lookup returns the registered provider with the given name.
+func Lookup(name string) (Provider, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	p, ok := providers[name]
+	return p, ok
+}
+
+// Names returns the sorted names of the registered providers.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}